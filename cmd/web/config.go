@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"frontend.njvanhaute.com/internal/validator"
+)
+
+// envPrefix is prepended to a flag's name, upper-cased and with dashes
+// replaced by underscores, to give the environment variable that sets it.
+// For example -db-dsn can be set with NJVANHAUTE_DB_DSN.
+const envPrefix = "NJVANHAUTE_"
+
+// secretSettings maps the names of settings which must not be shown by
+// -print-config to a function that redacts their value.
+var secretSettings = map[string]func(string) string{
+	"db-dsn":         redactDSN,
+	"session-secret": func(string) string { return "xxxxx" },
+}
+
+// legacyEnvNames maps settings to environment variables they were read from
+// before the NJVANHAUTE_ names existed, which are still accepted so existing
+// deployments keep working.
+var legacyEnvNames = map[string]string{
+	"backend-hostname": "JAMBUSTER_HOSTNAME",
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// lookupEnv returns the value of the environment variable for the named
+// setting, falling back to its legacy name, along with the variable used.
+func lookupEnv(flagName string) (value, name string, ok bool) {
+	name = envName(flagName)
+	if value, ok := os.LookupEnv(name); ok {
+		return value, name, true
+	}
+
+	if legacy, exists := legacyEnvNames[flagName]; exists {
+		if value, ok := os.LookupEnv(legacy); ok {
+			return value, legacy, true
+		}
+	}
+
+	return "", "", false
+}
+
+// loadConfig fills in any flags in fset which were not given on the command
+// line, first from the config file named by -config (or NJVANHAUTE_CONFIG)
+// and then from the environment. The resulting precedence is flags, then
+// environment variables, then the config file, then the flag defaults.
+func loadConfig(fset *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	path := fset.Lookup("config").Value.String()
+	if !explicit["config"] {
+		if value, ok := os.LookupEnv(envName("config")); ok {
+			path = value
+		}
+	}
+
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if fset.Lookup(name) == nil || name == "config" || name == "print-config" {
+				return fmt.Errorf("%s: unknown setting %q", path, name)
+			}
+
+			if _, _, ok := lookupEnv(name); ok || explicit[name] {
+				continue
+			}
+
+			err := fset.Set(name, values[name])
+			if err != nil {
+				return fmt.Errorf("%s: invalid value for %s: %w", path, name, err)
+			}
+		}
+	}
+
+	var err error
+
+	fset.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] || f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		value, name, ok := lookupEnv(f.Name)
+		if !ok {
+			return
+		}
+
+		if setErr := fset.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for %s: %w", name, setErr)
+		}
+	})
+
+	return err
+}
+
+// validateConfig checks the merged configuration, returning a validator
+// holding an error for each problem found.
+func validateConfig(cfg config) validator.Validator {
+	var v validator.Validator
+
+	v.CheckField(validator.PermittedValue(cfg.env, "development", "staging", "production"), "env", "must be one of development, staging or production")
+	v.CheckField(validator.NotBlank(cfg.addr), "addr", "must be provided")
+	v.CheckField(cfg.metricsAddr != cfg.addr, "metrics-addr", "must be different from -addr")
+	v.CheckField(cfg.shutdownTimeout > 0, "shutdown-timeout", "must be greater than zero")
+
+	v.CheckField(validator.PermittedValue(cfg.session.store, "postgres", "memory", "cookie"), "session-store", "must be one of postgres, memory or cookie")
+	if cfg.session.store == "postgres" {
+		v.CheckField(validator.NotBlank(cfg.db.dsn), "db-dsn", "must be provided when -session-store=postgres")
+	}
+	if cfg.session.store == "cookie" {
+		v.CheckField(validator.MinChars(cfg.session.secret, 32), "session-secret", "must be at least 32 characters long when -session-store=cookie")
+	}
+	v.CheckField(cfg.db.maxOpenConns >= 0, "db-max-open-conns", "must not be negative")
+	v.CheckField(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	v.CheckField(cfg.db.maxIdleTime >= 0, "db-max-idle-time", "must not be negative")
+
+	backend, err := url.Parse(cfg.backendHostname)
+	v.CheckField(err == nil && validator.PermittedValue(backend.Scheme, "http", "https") && backend.Host != "", "backend-hostname", "must be an absolute http or https URL")
+	if cfg.env == "production" {
+		v.CheckField(cfg.backendHostname != defaultBackendHostname, "backend-hostname", "must be set explicitly in production")
+	}
+	v.CheckField(cfg.apiMaxRequestTime > 0, "api-max-request-time", "must be greater than zero")
+
+	if cfg.limiter.enabled {
+		v.CheckField(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+		v.CheckField(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+		v.CheckField(cfg.limiter.loginMaxFailures > 0, "login-max-failures", "must be greater than zero")
+		v.CheckField(cfg.limiter.loginLockout > 0, "login-lockout", "must be greater than zero")
+	}
+
+	v.CheckField((cfg.tls.certFile == "") == (cfg.tls.keyFile == ""), "tls-cert", "must be used together with -tls-key")
+	if !cfg.tls.enabled {
+		v.CheckField(cfg.env == "development", "tls", "can only be disabled in development")
+		v.CheckField(cfg.tls.certFile == "", "tls-cert", "must not be used with -tls=false")
+	}
+
+	return v
+}
+
+// printConfig writes the value of every setting in fset to w as JSON, in a
+// form that can be used as a config file. Secrets are redacted.
+func printConfig(w io.Writer, fset *flag.FlagSet) error {
+	settings := map[string]any{}
+
+	fset.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		value := f.Value.String()
+		if redact, ok := secretSettings[f.Name]; ok && value != "" {
+			value = redact(value)
+		}
+		settings[f.Name] = value
+
+		// Keep booleans and numbers unquoted. Durations are left as strings
+		// such as "15m0s", which is also how the config file expects them.
+		if g, ok := f.Value.(flag.Getter); ok {
+			switch v := g.Get().(type) {
+			case bool, int, int64, uint, uint64, float64:
+				settings[f.Name] = v
+			}
+		}
+	})
+
+	js, err := json.MarshalIndent(settings, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(js, '\n'))
+	return err
+}
+
+var dsnPasswordRX = regexp.MustCompile(`password=('[^']*'|\S+)`)
+
+// redactDSN hides the password in a PostgreSQL connection string, in either
+// URL or keyword/value form.
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "xxxxx"
+		}
+
+		return u.Redacted()
+	}
+
+	return dsnPasswordRX.ReplaceAllString(dsn, "password=xxxxx")
+}
+
+// readConfigFile reads a JSON config file into a map from flag name to value.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseJSONConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// configKey turns a (possibly nested) key from a config file into a flag
+// name, so that "db.max_open_conns" and "db-max-open-conns" are equivalent.
+func configKey(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var root map[string]any
+	if err := dec.Decode(&root); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	if err := flattenJSON("", root, values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func flattenJSON(prefix string, value any, dst map[string]string) error {
+	if object, ok := value.(map[string]any); ok {
+		for key, child := range object {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+
+			if err := flattenJSON(key, child, dst); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	key := configKey(prefix)
+	if _, exists := dst[key]; exists {
+		return fmt.Errorf("duplicate setting %q", key)
+	}
+
+	if array, ok := value.([]any); ok {
+		items := make([]string, len(array))
+		for i, item := range array {
+			s, err := jsonScalar(key, item)
+			if err != nil {
+				return err
+			}
+			items[i] = s
+		}
+
+		dst[key] = strings.Join(items, ",")
+		return nil
+	}
+
+	s, err := jsonScalar(key, value)
+	if err != nil {
+		return err
+	}
+
+	dst[key] = s
+	return nil
+}
+
+func jsonScalar(key string, value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	default:
+		return "", fmt.Errorf("%s: unsupported value %v", key, value)
+	}
+}
+
+// prefixList is a flag.Value holding a comma-separated list of CIDR ranges.
+type prefixList []netip.Prefix
+
+func (p *prefixList) String() string {
+	items := make([]string, len(*p))
+	for i, prefix := range *p {
+		items[i] = prefix.String()
+	}
+
+	return strings.Join(items, ",")
+}
+
+func (p *prefixList) Set(value string) error {
+	prefixes, err := parseTrustedProxies(value)
+	if err != nil {
+		return err
+	}
+
+	*p = prefixes
+	return nil
+}
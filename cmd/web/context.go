@@ -0,0 +1,5 @@
+package main
+
+type contextKey string
+
+const clientIPContextKey = contextKey("clientIP")
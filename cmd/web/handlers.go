@@ -1,20 +1,46 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"frontend.njvanhaute.com/internal/models"
+	"frontend.njvanhaute.com/internal/jambuster"
 	"frontend.njvanhaute.com/internal/validator"
 )
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
+
+	// The backend only lists tunes for logged-in users, so anonymous visitors
+	// get a prompt to log in instead.
+	if !data.IsAuthenticated {
+		app.render(w, r, http.StatusOK, "home.html", data)
+		return
+	}
+
+	tunes, _, err := app.jambuster.ListTunes(r.Context(), app.authToken(r), jambuster.TuneFilters{Sort: "-id", PageSize: 10})
+	switch {
+	case errors.Is(err, jambuster.ErrInvalidAuthToken):
+		app.reauthenticate(w, r)
+		return
+
+	case errors.Is(err, jambuster.ErrForbidden):
+		// The account isn't allowed to read tunes, e.g. because it hasn't
+		// been activated. That's not an outage.
+		data.TunesForbidden = true
+
+	case err != nil:
+		// The home page should still render when the backend is unreachable,
+		// so log the error and show a friendly message instead of a 500.
+		app.logError(r, err)
+		data.TunesUnavailable = true
+	}
+
+	data.Tunes = tunes
 	app.render(w, r, http.StatusOK, "home.html", data)
 }
 
@@ -23,114 +49,468 @@ func (app *application) transcriptions(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, http.StatusOK, "transcriptions.html", data)
 }
 
+type tuneListForm struct {
+	Title               string `form:"title"`
+	Style               string `form:"style"`
+	Key                 string `form:"key"`
+	TimeSignature       string `form:"time_signature"`
+	Page                int    `form:"page"`
+	PageSize            int    `form:"page_size"`
+	Sort                string `form:"sort"`
+	validator.Validator `form:"-"`
+}
+
+// tuneListSortValues are the sort options offered on the tune browser.
+var tuneListSortValues = []string{"title", "-title", "id", "-id", "time_signature", "-time_signature"}
+
+func (app *application) tuneList(w http.ResponseWriter, r *http.Request) {
+	form := tuneListForm{
+		Page:     1,
+		PageSize: 20,
+		Sort:     "title",
+	}
+
+	err := app.decodeQuery(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.MaxChars(form.Title, 500), "title", "This field cannot be more than 500 characters long")
+	form.CheckField(form.Page > 0, "page", "Page must be greater than zero")
+	form.CheckField(form.Page <= 10_000_000, "page", "Page must be a maximum of 10 million")
+	form.CheckField(form.PageSize > 0, "page_size", "Page size must be greater than zero")
+	form.CheckField(form.PageSize <= 100, "page_size", "Page size must be a maximum of 100")
+	form.CheckField(validator.PermittedValue(form.Sort, tuneListSortValues...), "sort", "Invalid sort value")
+
+	data := app.newTemplateData(r)
+
+	if !form.Valid() {
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "tunes.html", data)
+		return
+	}
+
+	filters := jambuster.TuneFilters{
+		Title:         form.Title,
+		Style:         form.Style,
+		Key:           form.Key,
+		TimeSignature: form.TimeSignature,
+		Page:          form.Page,
+		PageSize:      form.PageSize,
+		Sort:          form.Sort,
+	}
+
+	tunes, metadata, err := app.jambuster.ListTunes(r.Context(), app.authToken(r), filters)
+	if err != nil {
+		// The backend names the style and key filters after the plural tune
+		// fields, so map them back onto the form inputs.
+		if addBackendErrors(&form, err, map[string]string{"styles": "style", "keys": "key"}) {
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "tunes.html", data)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+	data.Tunes = tunes
+	data.Pagination = newPagination(r.URL, metadata)
+	app.render(w, r, http.StatusOK, "tunes.html", data)
+}
+
 func (app *application) tuneView(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.PathValue("id"))
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 	if err != nil || id < 1 {
 		http.NotFound(w, r)
 		return
 	}
 
-	tune, err := app.GetTune(id, r)
+	tune, err := app.jambuster.GetTune(r.Context(), app.authToken(r), id)
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
+		switch {
+		case errors.Is(err, jambuster.ErrNotFound):
 			http.NotFound(w, r)
-		} else {
+
+		case errors.Is(err, jambuster.ErrForbidden):
+			app.sessionManager.Put(r.Context(), "flash", "You don't have permission to view that tune.")
+			http.Redirect(w, r, "/tunes", http.StatusSeeOther)
+
+		default:
 			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	fmt.Fprintf(w, "%+v", tune)
+	data := app.newTemplateData(r)
+	data.Tune = tune
+	app.render(w, r, http.StatusOK, "tune.html", data)
+}
+
+type tuneCreateForm struct {
+	Title               string `form:"title"`
+	Styles              string `form:"styles"`
+	Keys                string `form:"keys"`
+	TimeSignature       string `form:"time_signature"`
+	Structure           string `form:"structure"`
+	HasLyrics           bool   `form:"has_lyrics"`
+	validator.Validator `form:"-"`
 }
 
 func (app *application) tuneCreate(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Display a form for creating a new tune..."))
+	data := app.newTemplateData(r)
+	data.Form = tuneCreateForm{
+		TimeSignature: "4/4",
+	}
+	app.render(w, r, http.StatusOK, "create.html", data)
+}
+
+// validate checks the fields shared by the tune create and edit forms.
+func (form *tuneCreateForm) validate() {
+	styles := splitList(form.Styles)
+	keys := splitList(form.Keys)
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 500), "title", "This field cannot be more than 500 characters long")
+	form.CheckField(len(styles) > 0, "styles", "This field must contain at least one style")
+	form.CheckField(validator.Unique(styles), "styles", "This field must not contain duplicate styles")
+	form.CheckField(len(keys) > 0, "keys", "This field must contain at least one key")
+	form.CheckField(validator.Unique(keys), "keys", "This field must not contain duplicate keys")
+	form.CheckField(validator.NotBlank(form.TimeSignature), "time_signature", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.TimeSignature, validator.TimeSignatureRX), "time_signature", "This field must be a valid time signature (ex: 4/4)")
+	form.CheckField(validator.NotBlank(form.Structure), "structure", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Structure, 100), "structure", "This field cannot be more than 100 characters long")
+}
+
+// tune builds a Tune from the submitted form values.
+func (form *tuneCreateForm) tune() jambuster.Tune {
+	return jambuster.Tune{
+		Title:         form.Title,
+		Styles:        splitList(form.Styles),
+		Keys:          splitList(form.Keys),
+		TimeSignature: form.TimeSignature,
+		Structure:     form.Structure,
+		HasLyrics:     form.HasLyrics,
+	}
 }
 
 func (app *application) tuneCreatePost(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("Save a new tune..."))
+	var form tuneCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "create.html", data)
+		return
+	}
+
+	tune, err := app.jambuster.CreateTune(r.Context(), app.authToken(r), form.tune())
+	if err != nil {
+		if addBackendErrors(&form, err, nil) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "create.html", data)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Tune successfully created!")
+	http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", tune.ID), http.StatusSeeOther)
 }
 
-type userSignupForm struct {
-	Name                string `form:"name"`
-	Email               string `form:"email"`
-	Password            string `form:"password"`
-	validator.Validator `form:"-"`
+type tuneEditForm struct {
+	Version int32 `form:"version"`
+	tuneCreateForm
 }
 
-func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	data.Form = userSignupForm{}
-	app.render(w, r, http.StatusOK, "signup.html", data)
+func newTuneEditForm(tune jambuster.Tune) tuneEditForm {
+	return tuneEditForm{
+		Version: tune.Version,
+		tuneCreateForm: tuneCreateForm{
+			Title:         tune.Title,
+			Styles:        strings.Join(tune.Styles, ", "),
+			Keys:          strings.Join(tune.Keys, ", "),
+			TimeSignature: tune.TimeSignature,
+			Structure:     tune.Structure,
+			HasLyrics:     tune.HasLyrics,
+		},
+	}
 }
 
-type userSignupApiError struct {
-	Error struct {
-		Email string `json:"email"`
-	} `json:"error"`
+func (app *application) tuneEdit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	tune, err := app.jambuster.GetTune(r.Context(), app.authToken(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, jambuster.ErrNotFound):
+			http.NotFound(w, r)
+
+		case errors.Is(err, jambuster.ErrForbidden):
+			app.sessionManager.Put(r.Context(), "flash", "You don't have permission to edit that tune.")
+			http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", id), http.StatusSeeOther)
+
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tune = tune
+	data.Form = newTuneEditForm(tune)
+	app.render(w, r, http.StatusOK, "edit.html", data)
 }
 
-func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
-	var form userSignupForm
+func (app *application) tuneEditPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
 
-	err := app.decodePostForm(r, &form)
+	var form tuneEditForm
+
+	err = app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	current, err := app.jambuster.GetTune(r.Context(), app.authToken(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, jambuster.ErrNotFound):
+			http.NotFound(w, r)
+
+		case errors.Is(err, jambuster.ErrForbidden):
+			app.sessionManager.Put(r.Context(), "flash", "You don't have permission to edit that tune.")
+			http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", id), http.StatusSeeOther)
+
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	form.validate()
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
+		data.Tune = current
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.html", data)
 		return
 	}
 
-	postBody, err := json.Marshal(map[string]string{
-		"name":     form.Name,
-		"email":    form.Email,
-		"password": form.Password,
-	})
+	submitted := form.tune()
+
+	// Someone saved the tune after this form was rendered. The changes below
+	// are worked out against the current tune, so any field the other user
+	// changed would count as edited here. Sending that PATCH would put back
+	// this form's stale values, so show the conflict before making the call.
+	if current.Version != form.Version {
+		app.renderTuneEditConflict(w, r, form, current)
+		return
+	}
 
+	changes := changedTuneFields(current, submitted)
+	if len(changes) == 0 {
+		app.sessionManager.Put(r.Context(), "flash", "No changes to save.")
+		http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	_, err = app.jambuster.UpdateTune(r.Context(), app.authToken(r), id, form.Version, changes)
 	if err != nil {
-		app.serverError(w, r, err)
+		switch {
+		case addBackendErrors(&form, err, nil):
+			data := app.newTemplateData(r)
+			data.Tune = current
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "edit.html", data)
+
+		case errors.Is(err, jambuster.ErrEditConflict):
+			current, err = app.jambuster.GetTune(r.Context(), app.authToken(r), id)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			app.renderTuneEditConflict(w, r, form, current)
+
+		case errors.Is(err, jambuster.ErrNotFound):
+			http.NotFound(w, r)
+
+		case errors.Is(err, jambuster.ErrForbidden):
+			app.sessionManager.Put(r.Context(), "flash", "You don't have permission to edit that tune.")
+			http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", id), http.StatusSeeOther)
+
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	postBuffer := bytes.NewBuffer(postBody)
-	rawResp, err := app.httpClient.Post(app.buildURL("/v1/users"),
-		"application/json", postBuffer)
+	app.sessionManager.Put(r.Context(), "flash", "Tune successfully updated!")
+	http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", id), http.StatusSeeOther)
+}
+
+// renderTuneEditConflict re-renders the edit form with the user's submitted
+// values alongside the values currently stored by the backend. The form's
+// version is bumped to the current one, so submitting again overwrites the
+// other change.
+func (app *application) renderTuneEditConflict(w http.ResponseWriter, r *http.Request, form tuneEditForm, current jambuster.Tune) {
+	form.Version = current.Version
+	form.AddNonFieldError("Someone else changed this tune while you were editing it. Review their changes below, then save again to overwrite them.")
+
+	data := app.newTemplateData(r)
+	data.Tune = current
+	data.Form = form
+	data.Conflicts = tuneConflicts(current, form.tune())
+	app.render(w, r, http.StatusConflict, "edit.html", data)
+}
+
+func (app *application) tuneDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
 
+	tune, err := app.jambuster.GetTune(r.Context(), app.authToken(r), id)
 	if err != nil {
-		app.serverError(w, r, err)
+		switch {
+		case errors.Is(err, jambuster.ErrNotFound):
+			http.NotFound(w, r)
+
+		case errors.Is(err, jambuster.ErrForbidden):
+			app.sessionManager.Put(r.Context(), "flash", "You don't have permission to delete that tune.")
+			http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", id), http.StatusSeeOther)
+
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	defer rawResp.Body.Close()
+	data := app.newTemplateData(r)
+	data.Tune = tune
+	app.render(w, r, http.StatusOK, "delete.html", data)
+}
 
-	var parsedResp userSignupApiError
+func (app *application) tuneDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
 
-	err = app.readJSON(rawResp, &parsedResp)
+	err = app.jambuster.DeleteTune(r.Context(), app.authToken(r), id)
 	if err != nil {
-		app.serverError(w, r, err)
+		switch {
+		case errors.Is(err, jambuster.ErrNotFound):
+			app.sessionManager.Put(r.Context(), "flash", "That tune doesn't exist. It may have already been deleted.")
+			http.Redirect(w, r, "/tunes", http.StatusSeeOther)
+
+		case errors.Is(err, jambuster.ErrForbidden):
+			app.sessionManager.Put(r.Context(), "flash", "You don't have permission to delete that tune.")
+			http.Redirect(w, r, fmt.Sprintf("/tune/view/%d", id), http.StatusSeeOther)
+
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Tune successfully deleted!")
+	http.Redirect(w, r, "/tunes", http.StatusSeeOther)
+}
+
+// checkEmail records an error against key in v if email is blank or isn't a
+// valid email address.
+func checkEmail(v *validator.Validator, key, email string) {
+	v.CheckField(validator.NotBlank(email), key, "This field cannot be blank")
+	v.CheckField(validator.Matches(email, validator.EmailRX), key, "This field must be a valid email address")
+}
+
+// checkNewPassword records an error against key in v if password is blank or
+// shorter than 8 characters.
+func checkNewPassword(v *validator.Validator, key, password string) {
+	v.CheckField(validator.NotBlank(password), key, "This field cannot be blank")
+	v.CheckField(validator.MinChars(password, 8), key, "This field must be at least 8 characters long")
+}
+
+// checkToken records an error against key in v if token isn't the shape of
+// an activation or password reset token.
+func checkToken(v *validator.Validator, key, token string) {
+	v.CheckField(validator.NotBlank(token), key, "This field cannot be blank")
+	v.CheckField(len(token) == 26, key, "The token must be 26 characters long")
+}
+
+type userSignupForm struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userSignupForm{}
+	app.render(w, r, http.StatusOK, "signup.html", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	var form userSignupForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	if parsedResp.Error.Email != "" {
-		form.AddFieldError("email", "Email address is already in use")
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	checkEmail(&form.Validator, "email", form.Email)
+	checkNewPassword(&form.Validator, "password", form.Password)
+
+	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
 		app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
 		return
 	}
 
+	_, err = app.jambuster.RegisterUser(r.Context(), form.Name, form.Email, form.Password)
+	if err != nil {
+		if addBackendErrors(&form, err, nil) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.html", data)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
 	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please check your email for more information.")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -148,13 +528,6 @@ func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, http.StatusOK, "login.html", data)
 }
 
-type userAuthToken struct {
-	AuthToken struct {
-		Token  string    `json:"token"`
-		Expiry time.Time `json:"expiry"`
-	} `json:"authentication_token"`
-}
-
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	var form userLoginForm
 
@@ -164,8 +537,7 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	checkEmail(&form.Validator, "email", form.Email)
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 
 	if !form.Valid() {
@@ -175,52 +547,64 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	postBody, err := json.Marshal(map[string]string{
-		"email":    form.Email,
-		"password": form.Password,
-	})
+	// Count failures per email address as well as limiting each IP, so a
+	// password can't be guessed slowly from many addresses.
+	email := strings.ToLower(strings.TrimSpace(form.Email))
 
-	if err != nil {
-		app.serverError(w, r, err)
-		return
+	if app.limiterEnabled {
+		if locked, retryAfter := app.loginFailures.Locked(email); locked {
+			app.tooManyRequests(w, r, retryAfter)
+			return
+		}
 	}
 
-	postBuffer := bytes.NewBuffer(postBody)
-	resp, err := app.httpClient.Post(app.buildURL("/v1/tokens/authentication"),
-		"application/json", postBuffer)
-
+	authToken, err := app.jambuster.CreateAuthToken(r.Context(), form.Email, form.Password)
 	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
+		if addBackendErrors(&form, err, nil) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+			return
+		}
 
-	defer resp.Body.Close()
+		if errors.Is(err, jambuster.ErrInvalidCredentials) {
+			app.loginFailures.Fail(email)
+			form.AddNonFieldError("Invalid credentials. Please try again.")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnauthorized, "login.html", data)
+			return
+		}
 
-	if resp.StatusCode != http.StatusCreated {
-		form.AddNonFieldError("Invalid credentials. Please try again.")
-		data := app.newTemplateData(r)
-		data.Form = form
-		app.render(w, r, http.StatusUnauthorized, "login.html", data)
+		app.serverError(w, r, err)
 		return
 	}
 
-	var tokenResp userAuthToken
+	app.loginFailures.Reset(email)
 
-	err = app.readJSON(resp, &tokenResp)
+	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	err = app.sessionManager.RenewToken(r.Context())
+	app.sessionManager.Put(r.Context(), "authenticatedUserToken", authToken.Token)
+	app.sessionManager.Put(r.Context(), "authenticatedUserTokenExpiry", authToken.Expiry)
+
+	// The name is only used for display, so don't fail the login over it.
+	user, err := app.jambuster.GetCurrentUser(r.Context(), authToken.Token)
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		app.logError(r, err)
+	} else {
+		app.sessionManager.Put(r.Context(), "authenticatedUserName", user.Name)
 	}
 
-	app.sessionManager.Put(r.Context(), "authenticatedUserToken", tokenResp.AuthToken.Token)
-	app.logger.Info("token", "token", tokenResp.AuthToken.Token)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	path, ok := safeRedirectPath(app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin"))
+	if !ok {
+		path = "/"
+	}
+
+	http.Redirect(w, r, path, http.StatusSeeOther)
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
@@ -230,7 +614,7 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.sessionManager.Remove(r.Context(), "authenticatedUserToken")
+	app.clearAuthentication(r)
 	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -238,12 +622,22 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 
 type userActivateForm struct {
 	Token               string `form:"token"`
+	FromLink            bool   `form:"-"`
 	validator.Validator `form:"-"`
 }
 
+// userActivate displays the activation form. The link in the welcome email
+// carries the token as a query parameter, in which case the user only has to
+// confirm; activation itself still happens on POST so it is CSRF protected
+// and isn't triggered by link prefetchers.
 func (app *application) userActivate(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
 	data := app.newTemplateData(r)
-	data.Form = userActivateForm{}
+	data.Form = userActivateForm{
+		Token:    token,
+		FromLink: token != "",
+	}
 	app.render(w, r, http.StatusOK, "activate.html", data)
 }
 
@@ -256,8 +650,7 @@ func (app *application) userActivatePost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Token), "token", "This field cannot be blank")
-	form.CheckField(len(form.Token) == 26, "token", "The token must be 26 characters long")
+	checkToken(&form.Validator, "token", form.Token)
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
@@ -266,41 +659,357 @@ func (app *application) userActivatePost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	putBody, err := json.Marshal(map[string]string{
-		"token": form.Token,
-	})
+	_, err = app.jambuster.ActivateUser(r.Context(), form.Token)
+	if err != nil {
+		if addBackendErrors(&form, err, nil) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "activate.html", data)
+			return
+		}
 
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been activated! You can log in now.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+type userActivateResendForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userActivateResend(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userActivateResendForm{}
+	app.render(w, r, http.StatusOK, "activate_resend.html", data)
+}
+
+func (app *application) userActivateResendPost(w http.ResponseWriter, r *http.Request) {
+	var form userActivateResendForm
+
+	err := app.decodePostForm(r, &form)
 	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	checkEmail(&form.Validator, "email", form.Email)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "activate_resend.html", data)
+		return
+	}
+
+	// As with password resets, an unknown or already activated address gets
+	// the same response as a successful request, so the page can't be used
+	// to enumerate accounts.
+	err = app.jambuster.CreateActivationToken(r.Context(), form.Email)
+	var validationErr *jambuster.ValidationError
+	if err != nil && !errors.As(err, &validationErr) {
 		app.serverError(w, r, err)
 		return
 	}
 
-	putBuffer := bytes.NewBuffer(putBody)
-	req, err := http.NewRequest(http.MethodPut, app.buildURL("/v1/users/activate"), putBuffer)
+	app.sessionManager.Put(r.Context(), "flash", "If that email address belongs to an account awaiting activation, we've sent it a new activation token.")
+	http.Redirect(w, r, "/user/activate", http.StatusSeeOther)
+}
+
+type userPasswordForgotForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userPasswordForgotForm{}
+	app.render(w, r, http.StatusOK, "password_forgot.html", data)
+}
+
+func (app *application) userPasswordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form userPasswordForgotForm
+
+	err := app.decodePostForm(r, &form)
 	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	checkEmail(&form.Validator, "email", form.Email)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "password_forgot.html", data)
+		return
+	}
+
+	// The backend rejects addresses it doesn't know with a validation error.
+	// Treat that the same as success so this page can't be used to find out
+	// who has an account.
+	err = app.jambuster.CreatePasswordResetToken(r.Context(), form.Email)
+	var validationErr *jambuster.ValidationError
+	if err != nil && !errors.As(err, &validationErr) {
 		app.serverError(w, r, err)
+		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := app.httpClient.Do(req)
+	app.sessionManager.Put(r.Context(), "flash", "If an account exists for that email address, we've sent it instructions for resetting your password.")
+	http.Redirect(w, r, "/user/password/reset", http.StatusSeeOther)
+}
+
+type userPasswordResetForm struct {
+	Token               string `form:"token"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userPasswordResetForm{
+		Token: r.URL.Query().Get("token"),
+	}
+	app.render(w, r, http.StatusOK, "password_reset.html", data)
+}
+
+func (app *application) userPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	var form userPasswordResetForm
+
+	err := app.decodePostForm(r, &form)
 	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	checkToken(&form.Validator, "token", form.Token)
+	checkNewPassword(&form.Validator, "password", form.Password)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "password_reset.html", data)
+		return
+	}
+
+	err = app.jambuster.ResetPassword(r.Context(), form.Token, form.Password)
+	if err != nil {
+		if addBackendErrors(&form, err, nil) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "password_reset.html", data)
+			return
+		}
+
 		app.serverError(w, r, err)
 		return
 	}
 
-	if resp.StatusCode == http.StatusUnprocessableEntity {
-		form.AddFieldError("token", "Invalid or expired activation token")
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been reset. You can log in now.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) account(w http.ResponseWriter, r *http.Request) {
+	user, err := app.jambuster.GetCurrentUser(r.Context(), app.authToken(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Keep the name shown in the nav in step with the profile.
+	app.sessionManager.Put(r.Context(), "authenticatedUserName", user.Name)
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.AuthenticatedUserName = user.Name
+	app.render(w, r, http.StatusOK, "account.html", data)
+}
+
+// verifyCurrentPassword checks the password the user entered to confirm an
+// account change by exchanging it for a new token, the only way the backend
+// offers of checking it, and immediately revokes that token. Failures count
+// towards the same per-email lockout as logins. A wrong password is recorded
+// on the form; if the account is locked out, it returns how long for.
+func (app *application) verifyCurrentPassword(r *http.Request, v *validator.Validator, password string) (time.Duration, error) {
+	user, err := app.jambuster.GetCurrentUser(r.Context(), app.authToken(r))
+	if err != nil {
+		return 0, err
+	}
+
+	email := strings.ToLower(user.Email)
+
+	if app.limiterEnabled {
+		if locked, retryAfter := app.loginFailures.Locked(email); locked {
+			return retryAfter, nil
+		}
+	}
+
+	authToken, err := app.jambuster.CreateAuthToken(r.Context(), user.Email, password)
+	if errors.Is(err, jambuster.ErrInvalidCredentials) {
+		app.loginFailures.Fail(email)
+		v.AddFieldError("current_password", "Your current password is incorrect")
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	app.loginFailures.Reset(email)
+	app.revokeAuthToken(r, authToken.Token)
+
+	return 0, nil
+}
+
+// revokeAuthToken revokes a Jambuster token which is no longer needed. The
+// token expires anyway, so failures are logged rather than shown to the user.
+func (app *application) revokeAuthToken(r *http.Request, token string) {
+	err := app.jambuster.DeleteAuthToken(r.Context(), token)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// reauthenticateAfterAccountChange ends the user's session after they change
+// their credentials, revoking their Jambuster token, so they have to log in
+// again with the new ones.
+func (app *application) reauthenticateAfterAccountChange(w http.ResponseWriter, r *http.Request, flash string) {
+	app.revokeAuthToken(r, app.authToken(r))
+
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.clearAuthentication(r)
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+type accountPasswordForm struct {
+	CurrentPassword         string `form:"current_password"`
+	NewPassword             string `form:"new_password"`
+	NewPasswordConfirmation string `form:"new_password_confirmation"`
+	validator.Validator     `form:"-"`
+}
+
+func (app *application) accountPassword(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountPasswordForm{}
+	app.render(w, r, http.StatusOK, "account_password.html", data)
+}
+
+func (app *application) accountPasswordPost(w http.ResponseWriter, r *http.Request) {
+	var form accountPasswordForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "current_password", "This field cannot be blank")
+	checkNewPassword(&form.Validator, "new_password", form.NewPassword)
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "new_password_confirmation", "Passwords do not match")
+
+	if form.Valid() {
+		retryAfter, err := app.verifyCurrentPassword(r, &form.Validator, form.CurrentPassword)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if retryAfter > 0 {
+			app.tooManyRequests(w, r, retryAfter)
+			return
+		}
+	}
+
+	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "activate.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "account_password.html", data)
 		return
-	} else if resp.StatusCode != http.StatusOK {
+	}
+
+	_, err = app.jambuster.UpdateCurrentUser(r.Context(), app.authToken(r), jambuster.UserUpdate{
+		Password: &form.NewPassword,
+	})
+	if err != nil {
+		if addBackendErrors(&form, err, map[string]string{"password": "new_password"}) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "account_password.html", data)
+			return
+		}
+
 		app.serverError(w, r, err)
 		return
 	}
 
-	defer resp.Body.Close()
+	app.reauthenticateAfterAccountChange(w, r, "Your password has been changed. Please log in again with your new password.")
+}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your account has been activated! You can log in now.")
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+type accountEmailForm struct {
+	Email               string `form:"email"`
+	CurrentPassword     string `form:"current_password"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountEmail(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountEmailForm{}
+	app.render(w, r, http.StatusOK, "account_email.html", data)
+}
+
+func (app *application) accountEmailPost(w http.ResponseWriter, r *http.Request) {
+	var form accountEmailForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	checkEmail(&form.Validator, "email", form.Email)
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "current_password", "This field cannot be blank")
+
+	if form.Valid() {
+		retryAfter, err := app.verifyCurrentPassword(r, &form.Validator, form.CurrentPassword)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if retryAfter > 0 {
+			app.tooManyRequests(w, r, retryAfter)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "account_email.html", data)
+		return
+	}
+
+	_, err = app.jambuster.UpdateCurrentUser(r.Context(), app.authToken(r), jambuster.UserUpdate{
+		Email: &form.Email,
+	})
+	if err != nil {
+		if addBackendErrors(&form, err, nil) {
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "account_email.html", data)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.reauthenticateAfterAccountChange(w, r, "Your email address has been changed. Please log in again with your new email address.")
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// readinessTimeout bounds how long /readyz waits for each dependency.
+	readinessTimeout = 2 * time.Second
+
+	// readinessCacheTime is how long a readiness result is reused for, so
+	// that several monitors polling /readyz don't each hit the database and
+	// Jambuster.
+	readinessCacheTime = time.Second
+)
+
+// readinessCache holds the most recent readiness result. The zero value is
+// empty and ready to use.
+type readinessCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	status  int
+	data    map[string]any
+}
+
+// dependencyStatus is the publicly visible result of a readiness check.
+// Error details can reveal internal hosts and ports, so they are only
+// logged.
+type dependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// healthz reports that the process is up and able to serve requests. It
+// doesn't check any dependencies.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	app.writeHealth(w, http.StatusOK, map[string]any{
+		"status":  "available",
+		"version": version,
+	})
+}
+
+// readyz checks every dependency the frontend needs to serve pages: the
+// session database, when sessions are stored in PostgreSQL, and the
+// Jambuster backend. It responds 503 if any of them is down.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	status, data := app.checkReadiness()
+	app.writeHealth(w, status, data)
+}
+
+// checkReadiness runs the readiness checks, or returns the last result if it
+// is less than readinessCacheTime old. Callers arriving while a check is
+// running wait for it and share its result. The checks don't use any one
+// request's context, as the result outlives that request.
+func (app *application) checkReadiness() (int, map[string]any) {
+	app.readiness.mu.Lock()
+	defer app.readiness.mu.Unlock()
+
+	if time.Since(app.readiness.checked) < readinessCacheTime {
+		return app.readiness.status, app.readiness.data
+	}
+
+	checks := map[string]func(context.Context) error{
+		"jambuster": app.jambuster.Healthcheck,
+	}
+	if app.db != nil {
+		checks["database"] = app.db.PingContext
+	}
+
+	var (
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		dependencies = make(map[string]dependencyStatus, len(checks))
+	)
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+
+			status := dependencyStatus{
+				Status:    "up",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				status.Status = "down"
+				app.logger.Warn("dependency not ready", "dependency", name, "error", err.Error())
+			}
+
+			mu.Lock()
+			dependencies[name] = status
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	code, overall := http.StatusOK, "ready"
+	for _, dep := range dependencies {
+		if dep.Status != "up" {
+			code, overall = http.StatusServiceUnavailable, "unavailable"
+		}
+	}
+
+	app.readiness.checked = time.Now()
+	app.readiness.status = code
+	app.readiness.data = map[string]any{
+		"status":       overall,
+		"version":      version,
+		"dependencies": dependencies,
+	}
+
+	return app.readiness.status, app.readiness.data
+}
+
+func (app *application) writeHealth(w http.ResponseWriter, status int, data map[string]any) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		app.logger.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
@@ -1,43 +1,282 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"frontend.njvanhaute.com/internal/jambuster"
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
 )
 
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	// Every failed backend call ends up here, so this is the one place that
+	// needs to notice the backend rejecting the user's token.
+	if errors.Is(err, jambuster.ErrInvalidAuthToken) {
+		app.reauthenticate(w, r)
+		return
+	}
+
+	app.logError(r, err)
+
+	switch {
+	case clientGone(r, err):
+		// Nobody is listening for the response.
+		return
+
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+
+	case app.env == "development":
+		body := err.Error()
+
+		var pe *panicError
+		if errors.As(err, &pe) {
+			body += "\n\n" + string(pe.stack)
+		}
+
+		http.Error(w, body, http.StatusInternalServerError)
+
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// panicError is a panic recovered by the recoverPanic middleware, with the
+// stack captured where it happened so development error pages can show it.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprint(e.value)
+}
+
+// logError logs err against the request. Errors caused by the client going
+// away mid-request, which cancels any backend calls bound to its context, are
+// expected and logged as warnings rather than errors.
+func (app *application) logError(r *http.Request, err error) {
 	var (
 		method = r.Method
 		uri    = r.URL.RequestURI()
 	)
 
-	app.logger.Error(err.Error(), "method", method, "uri", uri)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	switch {
+	case clientGone(r, err):
+		app.logger.Warn("request canceled by client", "error", err.Error(), "method", method, "uri", uri)
+
+	case errors.Is(err, context.DeadlineExceeded):
+		app.logger.Error("backend request timed out", "error", err.Error(), "method", method, "uri", uri)
+
+	default:
+		app.logger.Error(err.Error(), "method", method, "uri", uri)
+	}
+}
+
+// clientGone reports whether err was caused by the request's context being
+// canceled, which happens when the client disconnects.
+func clientGone(r *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) && r.Context().Err() != nil
 }
 
 func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+func (app *application) tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	data := app.newTemplateData(r)
+	data.Error = errorPage{
+		Title:   "Too Many Attempts",
+		Message: fmt.Sprintf("You've made too many attempts. Please wait %s and try again.", humanWait(seconds)),
+	}
+	app.render(w, r, http.StatusTooManyRequests, "error.html", data)
+}
+
+// humanWait describes a wait of the given number of seconds, rounded up to
+// whole minutes once it is over a minute long.
+func humanWait(seconds int) string {
+	unit, n := "second", seconds
+	if seconds > 60 {
+		unit, n = "minute", (seconds+59)/60
+	}
+
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// clientIP returns the IP address of the client that made the request, as
+// resolved by the realIP middleware.
+func clientIP(r *http.Request) string {
+	ip, ok := r.Context().Value(clientIPContextKey).(netip.Addr)
+	if ok {
+		return ip.String()
+	}
+
+	return remoteIP(r).String()
+}
+
+// remoteIP returns the IP address of the immediate peer, which is the proxy
+// when running behind one.
+func remoteIP(r *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addrPort.Addr().Unmap()
+}
+
+// forwardedIP returns the client IP address recorded by trusted proxies in
+// the X-Forwarded-For or X-Real-IP headers. Proxies append to
+// X-Forwarded-For, so it is read from the right, skipping our own proxies;
+// anything left of the first untrusted address could have been made up by the
+// client. An unparsable hop means the chain can't be trusted, so it reports
+// no address and the caller falls back to the peer address.
+func (app *application) forwardedIP(r *http.Request) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	var ip netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			app.logger.Debug("ignoring X-Forwarded-For with an invalid hop", "peer", r.RemoteAddr, "hop", hops[i])
+			return netip.Addr{}, false
+		}
+
+		ip = hop.Unmap()
+		if !app.trustedProxy(ip) {
+			return ip, true
+		}
+	}
+
+	if ip.IsValid() {
+		return ip, true
+	}
+
+	ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return ip.Unmap(), true
+}
+
+func (app *application) trustedProxy(ip netip.Addr) bool {
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseTrustedProxies parses a comma-separated list of CIDR ranges. Bare IP
+// addresses are accepted as single-address ranges.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+
+			item = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// background runs fn in a goroutine which the server waits for when shutting
+// down. Long-running tasks should return once app.done is closed.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// cleanupRateLimiters periodically forgets clients the rate limiters haven't
+// seen for a while, until the application shuts down.
+func (app *application) cleanupRateLimiters() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			app.limiter.Cleanup(3 * time.Minute)
+			app.loginFailures.Cleanup()
+		case <-app.done:
+			return
+		}
+	}
+}
+
 func (app *application) newTemplateData(r *http.Request) templateData {
 	return templateData{
-		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		CurrentYear:           time.Now().Year(),
+		Flash:                 app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:       app.isAuthenticated(r),
+		AuthenticatedUserName: app.sessionManager.GetString(r.Context(), "authenticatedUserName"),
+		CSRFToken:             nosurf.Token(r),
 	}
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data templateData) {
-	ts, ok := app.templateCache[page]
+	templateCache := app.templateCache
+
+	if app.hotReload {
+		var err error
+
+		templateCache, err = newTemplateCache(os.DirFS("ui"))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	ts, ok := templateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
 		app.serverError(w, r, err)
@@ -46,10 +285,15 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 
 	w.WriteHeader(status)
 
+	start := time.Now()
+
 	err := ts.ExecuteTemplate(w, "base", data)
 	if err != nil {
 		app.serverError(w, r, err)
+		return
 	}
+
+	app.metrics.renderDuration.WithLabelValues(page).Observe(time.Since(start).Seconds())
 }
 
 func (app *application) decodePostForm(r *http.Request, dst any) error {
@@ -72,60 +316,193 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 	return nil
 }
 
-func (app *application) readJSON(r *http.Response, dst any) error {
-	maxBytes := 1_048_576
-	r.Body = http.MaxBytesReader(nil, r.Body, int64(maxBytes))
-
-	err := json.NewDecoder(r.Body).Decode(dst)
+func (app *application) decodeQuery(r *http.Request, dst any) error {
+	err := app.formDecoder.Decode(dst, r.URL.Query())
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
-		var maxBytesError *http.MaxBytesError
+		var invalidDecoderError *form.InvalidDecoderError
 
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		if errors.As(err, &invalidDecoderError) {
+			panic(err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// addBackendErrors copies the field errors from a backend failed-validation
+// response onto dst, which must be a pointer to a form struct embedding
+// validator.Validator. Backend fields are matched to the form's fields by
+// their `form` tags, after renaming through fieldNames where the two differ;
+// errors for fields the form doesn't have become non-field errors. It reports
+// whether err was a validation error at all.
+func addBackendErrors(dst any, err error, fieldNames map[string]string) bool {
+	var validationErr *jambuster.ValidationError
+
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	form, ok := dst.(interface {
+		AddFieldError(key, message string)
+		AddNonFieldError(message string)
+	})
+	if !ok {
+		panic(fmt.Sprintf("addBackendErrors: %T does not embed validator.Validator", dst))
+	}
+
+	formFields := formFieldNames(reflect.TypeOf(dst).Elem())
+
+	for field, message := range validationErr.Fields {
+		if name, ok := fieldNames[field]; ok {
+			field = name
+		}
+
+		if formFields[field] {
+			form.AddFieldError(field, backendMessage(message))
+		} else {
+			form.AddNonFieldError(backendMessage(field + " " + message))
+		}
+	}
 
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+	return true
+}
+
+// formFieldNames returns the set of names in the `form` tags of struct type t,
+// including those of embedded structs.
+func formFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("form")
 
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		switch {
+		case name == "-":
+			continue
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			for name := range formFieldNames(field.Type) {
+				names[name] = true
 			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case name != "":
+			names[name] = true
+		}
+	}
 
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+	return names
+}
 
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+// backendMessage turns a backend validation message such as "must be
+// provided" into a sentence matching the frontend's own messages.
+func backendMessage(message string) string {
+	if strings.HasPrefix(message, "must ") {
+		return "This field " + message
+	}
 
-		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+	r, size := utf8.DecodeRuneInString(message)
+	return string(unicode.ToUpper(r)) + message[size:]
+}
 
-		case errors.As(err, &invalidUnmarshalError):
-			panic(err)
+// clearAuthentication removes everything stored in the session about the
+// logged in user.
+func (app *application) clearAuthentication(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "authenticatedUserToken")
+	app.sessionManager.Remove(r.Context(), "authenticatedUserTokenExpiry")
+	app.sessionManager.Remove(r.Context(), "authenticatedUserName")
+}
+
+// rememberPathForLogin stores the page the user was trying to reach in the
+// session, so userLoginPost can send them back there afterwards.
+func (app *application) rememberPathForLogin(r *http.Request) {
+	path := r.URL.RequestURI()
 
-		default:
-			return err
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// A redirect can't replay a form submission, so use the page the form
+		// was submitted from instead, as long as it is one of ours.
+		referer, err := url.Parse(r.Referer())
+		if err != nil || referer.Host != r.Host {
+			return
 		}
+		path = referer.RequestURI()
 	}
 
-	return nil
+	if path, ok := safeRedirectPath(path); ok {
+		app.sessionManager.Put(r.Context(), "redirectPathAfterLogin", path)
+	}
+}
+
+// safeRedirectPath checks that path is a local path on this site, and not
+// something a browser would treat as a link to another host, such as
+// "//evil.example" or "/\evil.example". Percent-encoded forms of those are
+// rejected too, in case anything decodes the path again later. It returns the
+// path normalized to its path and query.
+func safeRedirectPath(path string) (string, bool) {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.ContainsAny(path, "\\\r\n\t") {
+		return "", false
+	}
+
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return "", false
+	}
+
+	if strings.HasPrefix(u.Path, "//") || strings.ContainsAny(u.Path, "\\\r\n\t") {
+		return "", false
+	}
+
+	return u.RequestURI(), true
+}
+
+// authToken returns the user's Jambuster bearer token from the session, or
+// the empty string if they aren't logged in.
+func (app *application) authToken(r *http.Request) string {
+	return app.sessionManager.GetString(r.Context(), "authenticatedUserToken")
 }
 
-func (app *application) buildURL(endpoint string) string {
-	var sb strings.Builder
+// splitList splits a comma-separated form value into its trimmed, non-empty
+// elements.
+func splitList(value string) []string {
+	var list []string
 
-	sb.WriteString(app.backendHostname)
-	sb.WriteString(endpoint)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
 
-	return sb.String()
+	return list
 }
 
 func (app *application) isAuthenticated(r *http.Request) bool {
-	return app.sessionManager.Exists(r.Context(), "authenticatedUserToken")
+	if !app.sessionManager.Exists(r.Context(), "authenticatedUserToken") {
+		return false
+	}
+
+	return !app.authTokenExpired(r)
+}
+
+// authTokenExpired reports whether the user's Jambuster token has passed the
+// expiry the backend gave when issuing it.
+func (app *application) authTokenExpired(r *http.Request) bool {
+	expiry := app.sessionManager.GetTime(r.Context(), "authenticatedUserTokenExpiry")
+	return !expiry.IsZero() && time.Now().After(expiry)
+}
+
+// reauthenticate logs the user out because their Jambuster token is no longer
+// valid, and sends them to the login page. The page they were on is
+// remembered so they can be sent back to it after logging in again.
+func (app *application) reauthenticate(w http.ResponseWriter, r *http.Request) {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.clearAuthentication(r)
+	app.rememberPathForLogin(r)
+	app.sessionManager.Put(r.Context(), "flash", "Your session has expired. Please log in again.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
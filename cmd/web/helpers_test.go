@@ -0,0 +1,219 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestSafeRedirectPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "Local path with query",
+			path:   "/tune/view/1?x=y",
+			want:   "/tune/view/1?x=y",
+			wantOK: true,
+		},
+		{
+			name: "Empty",
+			path: "",
+		},
+		{
+			name: "Protocol-relative URL",
+			path: "//evil.com",
+		},
+		{
+			name: "Backslash",
+			path: `/\evil.com`,
+		},
+		{
+			name: "Absolute URL",
+			path: "https://evil.com",
+		},
+		{
+			name: "Encoded slashes",
+			path: "/%2F%2Fevil.com",
+		},
+		{
+			name: "Encoded backslash",
+			path: "/%5Cevil.com",
+		},
+		{
+			name: "Relative path",
+			path: "evil.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := safeRedirectPath(tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %t; want %t", ok, tt.wantOK)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		trustedProxies: trusted,
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "No proxy",
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Client behind one proxy",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Read right to left past trusted hops",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Hops split across headers",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"198.51.100.1, 203.0.113.7", "10.0.0.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "All hops trusted",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "Garbage hop",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"203.0.113.7, garbage, 10.0.0.2"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "IPv6",
+			remoteAddr: "[::1]:1234",
+			forwarded:  []string{"2001:db8::1"},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "IPv4-mapped IPv6 hop",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"::ffff:203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Real-IP without X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			realIP:     "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Untrusted peer spoofing headers",
+			remoteAddr: "203.0.113.7:1234",
+			forwarded:  []string{"198.51.100.1"},
+			realIP:     "198.51.100.1",
+			want:       "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			})
+
+			app.realIP(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{
+			name:  "Empty",
+			value: "",
+		},
+		{
+			name:  "Ranges and bare addresses",
+			value: "10.0.0.0/8, 127.0.0.1,::1",
+			want: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("127.0.0.1/32"),
+				netip.MustParsePrefix("::1/128"),
+			},
+		},
+		{
+			name:  "Range is masked",
+			value: "192.168.1.5/24",
+			want:  []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")},
+		},
+		{
+			name:    "Invalid",
+			value:   "10.0.0.0/8,nope",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTrustedProxies(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,45 +3,94 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/gob"
 	"flag"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
+	"frontend.njvanhaute.com/internal/cookiestore"
+	"frontend.njvanhaute.com/internal/jambuster"
+	"frontend.njvanhaute.com/internal/ratelimit"
+	"frontend.njvanhaute.com/ui"
 	"github.com/alexedwards/scs/postgresstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
 	"github.com/go-playground/form/v4"
 	_ "github.com/lib/pq"
 )
 
+const defaultBackendHostname = "http://localhost:4000"
+
+// version is the build version, set at build time with
+// -ldflags="-X main.version=...".
+var version = "dev"
+
 type application struct {
-	logger          *slog.Logger
-	sessionManager  *scs.SessionManager
-	templateCache   map[string]*template.Template
-	formDecoder     *form.Decoder
-	httpClient      *http.Client
-	backendHostname string
+	logger         *slog.Logger
+	db             *sql.DB
+	sessionManager *scs.SessionManager
+	cookieStore    *cookiestore.Store
+	templateCache  map[string]*template.Template
+	formDecoder    *form.Decoder
+	jambuster      *jambuster.Client
+	limiter        *ratelimit.Limiter
+	loginFailures  *ratelimit.FailureCounter
+	limiterEnabled bool
+	trustedProxies []netip.Prefix
+	secureCookies  bool
+	wg             sync.WaitGroup
+	done           chan struct{}
+	env            string
+	hotReload      bool
+	metrics        *appMetrics
+	readiness      readinessCache
 }
 
 type config struct {
-	addr string
-	env  string
-	db   struct {
+	addr            string
+	metricsAddr     string
+	env             string
+	shutdownTimeout time.Duration
+	db              struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  time.Duration
 	}
+	session struct {
+		store  string
+		secret string
+	}
 	backendHostname   string
 	apiMaxRequestTime time.Duration
+	trustedProxies    []netip.Prefix
+	tls               struct {
+		enabled  bool
+		certFile string
+		keyFile  string
+	}
+	limiter struct {
+		enabled          bool
+		rps              float64
+		burst            int
+		loginMaxFailures int
+		loginLockout     time.Duration
+	}
 }
 
 func main() {
 	var cfg config
 	flag.StringVar(&cfg.addr, "addr", ":4200", "HTTP network address")
+	flag.StringVar(&cfg.metricsAddr, "metrics-addr", "localhost:4201", "Admin HTTP network address serving /metrics (empty to disable)")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time allowed for in-flight requests to finish on shutdown")
 
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
 
@@ -49,50 +98,196 @@ func main() {
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
 
-	flag.StringVar(&cfg.backendHostname, "backend-hostname", "http://localhost:4000", "Backend API hostname")
+	flag.StringVar(&cfg.session.store, "session-store", "postgres", "Session store (postgres|memory|cookie)")
+	flag.StringVar(&cfg.session.secret, "session-secret", "", "Secret used to encrypt sessions with the cookie session store")
 
-	flag.DurationVar(&cfg.apiMaxRequestTime, "api-max-request-time", 10*time.Second, "Backend API max time to wait for repsonse")
+	flag.StringVar(&cfg.backendHostname, "backend-hostname", defaultBackendHostname, "Backend API hostname")
 
-	flag.Parse()
+	flag.DurationVar(&cfg.apiMaxRequestTime, "api-max-request-time", 10*time.Second, "Backend API max time to wait for each response")
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiting of login and signup attempts")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 0.5, "Rate limiter maximum requests per second per client IP")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 5, "Rate limiter maximum burst per client IP")
+	flag.IntVar(&cfg.limiter.loginMaxFailures, "login-max-failures", 5, "Failed logins per email address before it is locked out")
+	flag.DurationVar(&cfg.limiter.loginLockout, "login-lockout", 15*time.Minute, "How long an email address is locked out after too many failed logins")
 
-	db, err := openDB(cfg)
+	flag.Var((*prefixList)(&cfg.trustedProxies), "trusted-proxies", "Comma-separated CIDR ranges of proxies trusted to set X-Forwarded-For and X-Real-IP")
+
+	flag.BoolVar(&cfg.tls.enabled, "tls", true, "Serve over HTTPS and mark cookies Secure (may only be disabled in development)")
+	flag.StringVar(&cfg.tls.certFile, "tls-cert", "", "TLS certificate file to serve HTTPS with")
+	flag.StringVar(&cfg.tls.keyFile, "tls-key", "", "TLS private key file to serve HTTPS with")
+
+	flag.String("config", "", "JSON config file to read settings from")
+	printCfg := flag.Bool("print-config", false, "Print the effective configuration, with secrets redacted, and exit")
+
+	flag.Parse()
+
+	err := loadConfig(flag.CommandLine)
 	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *printCfg {
+		err = printConfig(os.Stdout, flag.CommandLine)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if v := validateConfig(cfg); !v.Valid() {
+		keys := make([]string, 0, len(v.FieldErrors))
+		for key := range v.FieldErrors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(os.Stderr, "invalid -%s: %s\n", key, v.FieldErrors[key])
+		}
+		os.Exit(2)
+	}
+
+	if *printCfg {
+		return
+	}
+
+	logger := newLogger(cfg.env)
+
+	// Cookies are marked Secure, so development needs HTTPS too unless it's
+	// turned off with -tls=false. Use a self-signed certificate rather than
+	// requiring Caddy locally.
+	if cfg.env == "development" && cfg.tls.enabled && cfg.tls.certFile == "" {
+		certFile, keyFile, generated, err := devCertificate("tls")
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		if generated {
+			logger.Info("generated self-signed development certificate", "cert", certFile)
+		}
+
+		cfg.tls.certFile, cfg.tls.keyFile = certFile, keyFile
 	}
-	defer db.Close()
 
-	templateCache, err := newTemplateCache()
+	templateCache, err := newTemplateCache(ui.Files)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
+	// In development, re-read the templates from disk on every request so
+	// changes show up without a restart. That only works when running from
+	// the repository root.
+	hotReload := false
+	if cfg.env == "development" {
+		if _, err := os.Stat("ui/html"); err == nil {
+			hotReload = true
+			logger.Debug("reloading templates from ./ui on each request")
+		}
+	}
+
+	// Session values are gob encoded, which needs to know about any
+	// non-builtin types stored in them.
+	gob.Register(time.Time{})
+
+	// Staging and production are always served over HTTPS by Caddy, so their
+	// cookies are always Secure. Development is too, unless -tls=false.
+	secureCookies := cfg.env != "development" || cfg.tls.enabled
+
 	sessionManager := scs.New()
-	sessionManager.Store = postgresstore.New(db)
+	sessionManager.Cookie.Secure = secureCookies
+
+	var (
+		db          *sql.DB
+		cookieStore *cookiestore.Store
+	)
+
+	switch cfg.session.store {
+	case "postgres":
+		db, err = openDB(cfg)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		sessionStore := postgresstore.New(db)
+		defer sessionStore.StopCleanup()
+
+		sessionManager.Store = sessionStore
+
+	case "memory":
+		sessionStore := memstore.New()
+		defer sessionStore.StopCleanup()
+
+		sessionManager.Store = sessionStore
+
+	case "cookie":
+		cookieStore, err = cookiestore.New(cfg.session.secret, http.Cookie{
+			Name:     sessionManager.Cookie.Name + "_data",
+			Path:     sessionManager.Cookie.Path,
+			Domain:   sessionManager.Cookie.Domain,
+			Secure:   sessionManager.Cookie.Secure,
+			HttpOnly: sessionManager.Cookie.HttpOnly,
+			SameSite: sessionManager.Cookie.SameSite,
+		})
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		sessionManager.Store = cookieStore
+	}
 
 	formDecoder := form.NewDecoder()
 
-	httpClient := &http.Client{
-		Timeout: cfg.apiMaxRequestTime,
+	appMetrics := newAppMetrics()
+
+	backendClient := &http.Client{
+		Transport: &instrumentedTransport{next: http.DefaultTransport, metrics: appMetrics},
 	}
 
 	app := &application{
-		logger:          logger,
-		sessionManager:  sessionManager,
-		templateCache:   templateCache,
-		formDecoder:     formDecoder,
-		httpClient:      httpClient,
-		backendHostname: cfg.backendHostname,
+		logger:         logger,
+		db:             db,
+		sessionManager: sessionManager,
+		cookieStore:    cookieStore,
+		templateCache:  templateCache,
+		formDecoder:    formDecoder,
+		jambuster:      jambuster.New(cfg.backendHostname, backendClient, cfg.apiMaxRequestTime),
+		limiter:        ratelimit.NewLimiter(cfg.limiter.rps, cfg.limiter.burst),
+		loginFailures:  ratelimit.NewFailureCounter(cfg.limiter.loginMaxFailures, cfg.limiter.loginLockout),
+		limiterEnabled: cfg.limiter.enabled,
+		trustedProxies: cfg.trustedProxies,
+		secureCookies:  secureCookies,
+		done:           make(chan struct{}),
+		env:            cfg.env,
+		hotReload:      hotReload,
+		metrics:        appMetrics,
+	}
+
+	sessionManager.ErrorFunc = app.sessionError
+
+	app.background(app.cleanupRateLimiters)
+
+	err = app.serve(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
+}
 
-	logger.Info("starting server", "addr", cfg.addr)
+// newLogger returns a human-readable debug logger for development, and a
+// structured JSON logger at info level everywhere else.
+func newLogger(env string) *slog.Logger {
+	if env == "development" {
+		return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
 
-	err = http.ListenAndServe(cfg.addr, app.routes())
-	logger.Error(err.Error())
-	os.Exit(1)
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 }
 
 func openDB(cfg config) (*sql.DB, error) {
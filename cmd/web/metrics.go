@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justinas/alice"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// renderBuckets are histogram buckets, in seconds, for template rendering,
+// which is much quicker than a whole request.
+var renderBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1}
+
+type appMetrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	inFlight        prometheus.Gauge
+	backendDuration *prometheus.HistogramVec
+	backendRequests *prometheus.CounterVec
+	sessionErrors   prometheus.Counter
+	renderDuration  *prometheus.HistogramVec
+}
+
+func newAppMetrics() *appMetrics {
+	m := &appMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests handled, by route pattern and status code.",
+		}, []string{"route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests, by route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests currently being handled.",
+		}),
+		backendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jambuster_request_duration_seconds",
+			Help:    "Time taken for Jambuster API calls to respond, by endpoint.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		backendRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jambuster_requests_total",
+			Help: "Jambuster API calls, by endpoint and status class (2xx, 3xx, 4xx, 5xx, or error if no response was received).",
+		}, []string{"endpoint", "class"}),
+		sessionErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "session_store_errors_total",
+			Help: "Errors loading or saving sessions.",
+		}),
+		renderDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "template_render_duration_seconds",
+			Help:    "Time taken to render page templates, by page.",
+			Buckets: renderBuckets,
+		}, []string{"page"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.inFlight,
+		m.backendDuration,
+		m.backendRequests,
+		m.sessionErrors,
+		m.renderDuration,
+	)
+
+	return m
+}
+
+// instrument returns middleware recording the count, latency and status of
+// requests handled by mux, labelled with the route pattern they matched so
+// that path parameters don't each get their own series.
+func (app *application) instrument(mux *http.ServeMux) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+
+			app.metrics.inFlight.Inc()
+			defer app.metrics.inFlight.Dec()
+
+			sw := &statusRecorder{ResponseWriter: w}
+			start := time.Now()
+
+			next.ServeHTTP(sw, r)
+
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			app.metrics.requests.WithLabelValues(route, strconv.Itoa(status)).Inc()
+			app.metrics.requestDuration.WithLabelValues(route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusRecorder) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusRecorder) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusRecorder) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// sessionError is the session manager's ErrorFunc. It counts the failure
+// before handling it like any other server error.
+func (app *application) sessionError(w http.ResponseWriter, r *http.Request, err error) {
+	app.metrics.sessionErrors.Inc()
+	app.serverError(w, r, err)
+}
+
+// instrumentedTransport records the latency and outcome of calls to the
+// Jambuster API.
+type instrumentedTransport struct {
+	next    http.RoundTripper
+	metrics *appMetrics
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.Method + " " + backendEndpoint(req.URL.Path)
+	start := time.Now()
+
+	resp, err := t.next.RoundTrip(req)
+
+	t.metrics.backendDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+	class := "error"
+	if err == nil {
+		class = statusClass(resp.StatusCode)
+	}
+	t.metrics.backendRequests.WithLabelValues(endpoint, class).Inc()
+
+	return resp, err
+}
+
+// statusClass returns the class of an HTTP status code, such as "4xx".
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// backendEndpoint replaces the IDs in a Jambuster API path with a
+// placeholder, so "/v1/tunes/12" becomes "/v1/tunes/{id}".
+func backendEndpoint(path string) string {
+	segments := strings.Split(path, "/")
+
+	for i, segment := range segments {
+		if _, err := strconv.ParseInt(segment, 10, 64); err == nil {
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// adminRoutes returns the handler for the admin listener, which is kept off
+// the public address.
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /metrics", promhttp.HandlerFor(app.metrics.registry, promhttp.HandlerOpts{}))
+
+	return mux
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"net/http"
+	"runtime/debug"
 
 	"github.com/justinas/nosurf"
 )
@@ -23,10 +24,29 @@ func commonHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// realIP resolves the real client IP address for requests which came through
+// a trusted proxy, and stores it in the request context for clientIP. The
+// forwarding headers are ignored on direct connections, where a client could
+// set them to anything.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r)
+
+		if app.trustedProxy(ip) {
+			if forwarded, ok := app.forwardedIP(r); ok {
+				ip = forwarded
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), clientIPContextKey, ip)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
-			ip     = r.RemoteAddr
+			ip     = clientIP(r)
 			proto  = r.Proto
 			method = r.Method
 			uri    = r.URL.RequestURI()
@@ -43,7 +63,7 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		defer func() {
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverError(w, r, fmt.Errorf("%s", err))
+				app.serverError(w, r, &panicError{value: err, stack: debug.Stack()})
 			}
 		}()
 
@@ -53,7 +73,13 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 
 func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.sessionManager.Exists(r.Context(), "authenticatedUserToken") && app.authTokenExpired(r) {
+			app.reauthenticate(w, r)
+			return
+		}
+
 		if !app.isAuthenticated(r) {
+			app.rememberPathForLogin(r)
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
@@ -63,12 +89,27 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
-func noSurf(next http.Handler) http.Handler {
+// rateLimit limits how often each client IP can hit the routes it wraps,
+// which are the ones that cost a backend call or send email on every attempt.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.limiterEnabled {
+			if ok, retryAfter := app.limiter.Allow(clientIP(r)); !ok {
+				app.tooManyRequests(w, r, retryAfter)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/",
-		Secure:   true,
+		Secure:   app.secureCookies,
 	})
 
 	return csrfHandler
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
+	"net/http/pprof"
 
 	"frontend.njvanhaute.com/ui"
 	"github.com/justinas/alice"
@@ -12,24 +14,64 @@ func (app *application) routes() http.Handler {
 
 	mux.Handle("GET /static/", http.FileServerFS(ui.Files))
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf)
+	if app.env == "development" {
+		mux.Handle("GET /debug/vars", expvar.Handler())
+		mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+		mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	}
+
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.noSurf)
+	if app.cookieStore != nil {
+		dynamic = alice.New(app.cookieStore.Middleware).Extend(dynamic)
+	}
+	limited := dynamic.Append(app.rateLimit)
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
 	mux.Handle("GET /transcriptions", dynamic.ThenFunc(app.transcriptions))
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
-	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
+	mux.Handle("POST /user/signup", limited.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/activate", dynamic.ThenFunc(app.userActivate))
 	mux.Handle("POST /user/activate", dynamic.ThenFunc(app.userActivatePost))
+	mux.Handle("GET /user/activate/resend", dynamic.ThenFunc(app.userActivateResend))
+	mux.Handle("POST /user/activate/resend", limited.ThenFunc(app.userActivateResendPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
-	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
+	mux.Handle("POST /user/login", limited.ThenFunc(app.userLoginPost))
+	mux.Handle("GET /user/password/forgot", dynamic.ThenFunc(app.userPasswordForgot))
+	mux.Handle("POST /user/password/forgot", limited.ThenFunc(app.userPasswordForgotPost))
+	mux.Handle("GET /user/password/reset", dynamic.ThenFunc(app.userPasswordReset))
+	mux.Handle("POST /user/password/reset", dynamic.ThenFunc(app.userPasswordResetPost))
 
 	protected := dynamic.Append(app.requireAuthentication)
+	protectedLimited := protected.Append(app.rateLimit)
 
 	mux.Handle("GET /tune/create", protected.ThenFunc(app.tuneCreate))
 	mux.Handle("POST /tune/create", protected.ThenFunc(app.tuneCreatePost))
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
+	mux.Handle("GET /account", protected.ThenFunc(app.account))
+	mux.Handle("GET /account/password", protected.ThenFunc(app.accountPassword))
+	mux.Handle("POST /account/password", protectedLimited.ThenFunc(app.accountPasswordPost))
+	mux.Handle("GET /account/email", protected.ThenFunc(app.accountEmail))
+	mux.Handle("POST /account/email", protectedLimited.ThenFunc(app.accountEmailPost))
+	mux.Handle("GET /tunes", protected.ThenFunc(app.tuneList))
 	mux.Handle("GET /tune/view/{id}", protected.ThenFunc(app.tuneView))
+	mux.Handle("GET /tune/edit/{id}", protected.ThenFunc(app.tuneEdit))
+	mux.Handle("POST /tune/edit/{id}", protected.ThenFunc(app.tuneEditPost))
+	mux.Handle("GET /tune/delete/{id}", protected.ThenFunc(app.tuneDelete))
+	mux.Handle("POST /tune/delete/{id}", protected.ThenFunc(app.tuneDeletePost))
+
+	standard := alice.New(app.instrument(mux), app.recoverPanic, app.realIP, app.logRequest, commonHeaders)
+
+	// Health checks are polled every few seconds, so they are kept out of
+	// the request log and metrics rather than drowning out real traffic.
+	probes := alice.New(app.recoverPanic)
+
+	root := http.NewServeMux()
+	root.Handle("GET /healthz", probes.ThenFunc(app.healthz))
+	root.Handle("GET /readyz", probes.ThenFunc(app.readyz))
+	root.Handle("/", standard.Then(mux))
 
-	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders)
-	return standard.Then(mux)
+	return root
 }
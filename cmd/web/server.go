@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxBackendCalls is the most Jambuster API calls a single request makes,
+	// each of which can take up to -api-max-request-time. Changing an
+	// account's password or email checks the current password (fetch the
+	// user, create a token, revoke it), saves the change and then revokes
+	// the session's token.
+	maxBackendCalls = 5
+
+	// pprofProfileTime is how long /debug/pprof/profile collects a CPU
+	// profile for by default. It refuses to run if that doesn't fit in the
+	// write timeout.
+	pprofProfileTime = 30 * time.Second
+)
+
+// serve runs the HTTP server until it receives SIGINT or SIGTERM, then stops
+// accepting connections and gives in-flight requests and background tasks up
+// to cfg.shutdownTimeout to finish. It returns nil after a clean shutdown.
+func (app *application) serve(cfg config) error {
+	// Leave room for a handler to wait the full backend timeout on every call
+	// it makes and still write its response.
+	writeTimeout := maxBackendCalls*cfg.apiMaxRequestTime + 10*time.Second
+	if app.env == "development" {
+		writeTimeout = max(writeTimeout, pprofProfileTime+10*time.Second)
+	}
+
+	srv := &http.Server{
+		Addr:         cfg.addr,
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: writeTimeout,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		TLSConfig:    newTLSConfig(),
+	}
+
+	var adminSrv *http.Server
+	if cfg.metricsAddr != "" {
+		adminSrv = &http.Server{
+			Addr:         cfg.metricsAddr,
+			Handler:      app.adminRoutes(),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		}
+
+		// Bind the admin address before starting anything, so that a port
+		// clash is returned like the main server's would be rather than
+		// leaving the site running without metrics.
+		ln, err := net.Listen("tcp", adminSrv.Addr)
+		if err != nil {
+			return fmt.Errorf("admin server: %w", err)
+		}
+
+		go func() {
+			app.logger.Info("starting admin server", "addr", adminSrv.Addr)
+
+			err := adminSrv.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.Error("admin server failed", "addr", adminSrv.Addr, "error", err.Error())
+			}
+		}()
+	}
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+		defer cancel()
+
+		// Carry on through every step even if one fails, so background
+		// tasks are always told to stop.
+		var errs []error
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if adminSrv != nil {
+			err = adminSrv.Shutdown(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("admin server: %w", err))
+			}
+		}
+
+		app.logger.Info("completing background tasks", "addr", srv.Addr)
+
+		close(app.done)
+
+		waited := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(waited)
+		}()
+
+		select {
+		case <-waited:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("background tasks: %w", ctx.Err()))
+		}
+
+		shutdownError <- errors.Join(errs...)
+	}()
+
+	var err error
+
+	if cfg.tls.certFile != "" {
+		app.logger.Info("starting server", "addr", srv.Addr, "env", cfg.env, "version", version, "tls", true)
+		err = srv.ListenAndServeTLS(cfg.tls.certFile, cfg.tls.keyFile)
+	} else {
+		app.logger.Info("starting server", "addr", srv.Addr, "env", cfg.env, "version", version, "tls", false)
+		err = srv.ListenAndServe()
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server", "addr", srv.Addr)
+
+	return nil
+}
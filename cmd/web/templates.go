@@ -3,32 +3,122 @@ package main
 import (
 	"html/template"
 	"io/fs"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"time"
 
-	"frontend.njvanhaute.com/ui"
+	"frontend.njvanhaute.com/internal/jambuster"
 )
 
 type templateData struct {
-	CurrentYear     int
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
+	CurrentYear           int
+	Form                  any
+	Flash                 string
+	IsAuthenticated       bool
+	AuthenticatedUserName string
+	CSRFToken             string
+	Tune                  jambuster.Tune
+	Tunes                 []jambuster.Tune
+	TunesUnavailable      bool
+	TunesForbidden        bool
+	Pagination            *pagination
+	Conflicts             []tuneConflict
+	User                  jambuster.User
+	Error                 errorPage
+}
+
+// errorPage is the content of error.html.
+type errorPage struct {
+	Title   string
+	Message string
+}
+
+// pagination holds what the pagination partial needs to render page links for
+// a listing. Any other query parameters on the current URL, such as filters,
+// are carried over into the generated links.
+type pagination struct {
+	jambuster.Metadata
+	path  string
+	query url.Values
+}
+
+func newPagination(u *url.URL, metadata jambuster.Metadata) *pagination {
+	query := url.Values{}
+
+	for key, values := range u.Query() {
+		if key == "page" {
+			continue
+		}
+
+		for _, value := range values {
+			if value != "" {
+				query.Add(key, value)
+			}
+		}
+	}
+
+	return &pagination{
+		Metadata: metadata,
+		path:     u.Path,
+		query:    query,
+	}
+}
+
+func (p *pagination) URL(page int) string {
+	query := url.Values{}
+	for key, values := range p.query {
+		query[key] = values
+	}
+	query.Set("page", strconv.Itoa(page))
+
+	return p.path + "?" + query.Encode()
+}
+
+func (p *pagination) HasPrevious() bool {
+	return p.CurrentPage > p.FirstPage
+}
+
+func (p *pagination) HasNext() bool {
+	return p.CurrentPage < p.LastPage
+}
+
+// Pages returns the page numbers to link to directly: a small window either
+// side of the current page.
+func (p *pagination) Pages() []int {
+	const window = 2
+
+	first := max(p.FirstPage, p.CurrentPage-window)
+	last := min(p.LastPage, p.CurrentPage+window)
+
+	var pages []int
+	for page := first; page <= last; page++ {
+		pages = append(pages, page)
+	}
+
+	return pages
 }
 
 func humanDate(t time.Time) string {
-	return t.Format("Feb 06 1998 at 17:01")
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"inc":       func(n int) int { return n + 1 },
+	"dec":       func(n int) int { return n - 1 },
 }
 
-func newTemplateCache() (map[string]*template.Template, error) {
+// newTemplateCache parses the templates in fsys, which is normally the
+// embedded ui.Files.
+func newTemplateCache(fsys fs.FS) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
-	pages, err := fs.Glob(ui.Files, "html/pages/*.html")
+	pages, err := fs.Glob(fsys, "html/pages/*.html")
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +132,7 @@ func newTemplateCache() (map[string]*template.Template, error) {
 			page,
 		}
 
-		ts, err := template.New(name).Funcs(functions).ParseFS(ui.Files, patterns...)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, patterns...)
 		if err != nil {
 			return nil, err
 		}
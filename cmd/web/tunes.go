@@ -2,61 +2,77 @@ package main
 
 import (
 	"fmt"
-	"net/http"
-	"time"
+	"reflect"
+	"strings"
 
-	"frontend.njvanhaute.com/internal/models"
+	"frontend.njvanhaute.com/internal/jambuster"
 )
 
-type Tune struct {
-	ID            int64     `json:"id"`             // Unique integer ID for the tune
-	CreatedAt     time.Time `json:"-"`              // Timestamp for when the tune is added to our database
-	Title         string    `json:"title"`          // Tune title
-	Styles        []string  `json:"styles"`         // Slice of styles for the tune (Bluegrass, old time, Irish, etc.)
-	Keys          []string  `json:"keys"`           // Slice of keys for the tune (ex: A major, G minor)
-	TimeSignature string    `json:"time_signature"` // Tune time signature
-	Structure     string    `json:"structure"`      // Tune structure (ex: AABA)
-	HasLyrics     bool      `json:"has_lyrics"`     // Whether or not the tune has lyrics
+// tuneFields describes the editable fields of a Tune, keyed by their JSON
+// names, for building partial updates and showing edit conflicts.
+var tuneFields = []struct {
+	name  string
+	label string
+	value func(jambuster.Tune) any
+}{
+	{"title", "Title", func(t jambuster.Tune) any { return t.Title }},
+	{"styles", "Styles", func(t jambuster.Tune) any { return t.Styles }},
+	{"keys", "Keys", func(t jambuster.Tune) any { return t.Keys }},
+	{"time_signature", "Time Signature", func(t jambuster.Tune) any { return t.TimeSignature }},
+	{"structure", "Structure", func(t jambuster.Tune) any { return t.Structure }},
+	{"has_lyrics", "Has Lyrics", func(t jambuster.Tune) any { return t.HasLyrics }},
 }
 
-type TuneEnvelope struct {
-	Tune Tune `json:"tune"`
-}
-
-func (app *application) Insert(tune Tune) (int, error) {
-	return 0, nil
-}
+// changedTuneFields returns the fields of updated which differ from original,
+// keyed by JSON name, suitable for a PATCH request body.
+func changedTuneFields(original, updated jambuster.Tune) map[string]any {
+	changes := make(map[string]any)
 
-func (app *application) GetTune(id int, r *http.Request) (Tune, error) {
-	endpoint := fmt.Sprintf("/v1/tunes/%d", id)
-
-	req, err := http.NewRequest(http.MethodGet, app.buildURL(endpoint), nil)
-	if err != nil {
-		return Tune{}, err
+	for _, field := range tuneFields {
+		if !reflect.DeepEqual(field.value(original), field.value(updated)) {
+			changes[field.name] = field.value(updated)
+		}
 	}
 
-	token := app.sessionManager.Get(r.Context(), "authenticatedUserToken")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	resp, err := app.httpClient.Do(req)
+	return changes
+}
 
-	if err != nil {
-		return Tune{}, err
-	}
+// tuneConflict is a field whose submitted value differs from the value
+// currently stored by the backend.
+type tuneConflict struct {
+	Label     string
+	Current   string
+	Submitted string
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return Tune{}, models.ErrNoRecord
-	}
+func tuneConflicts(current, submitted jambuster.Tune) []tuneConflict {
+	var conflicts []tuneConflict
 
-	var tuneEnvelope TuneEnvelope
+	for _, field := range tuneFields {
+		currentValue, submittedValue := field.value(current), field.value(submitted)
 
-	err = app.readJSON(resp, &tuneEnvelope)
-	if err != nil {
-		return Tune{}, err
+		if !reflect.DeepEqual(currentValue, submittedValue) {
+			conflicts = append(conflicts, tuneConflict{
+				Label:     field.label,
+				Current:   displayValue(currentValue),
+				Submitted: displayValue(submittedValue),
+			})
+		}
 	}
 
-	return tuneEnvelope.Tune, nil
+	return conflicts
 }
 
-func (app *application) Latest() ([]Tune, error) {
-	return nil, nil
+func displayValue(value any) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ", ")
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	default:
+		return fmt.Sprint(v)
+	}
 }
@@ -0,0 +1,180 @@
+package cookiestore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxCookieSize is the largest cookie value browsers can be relied on to
+// store.
+const maxCookieSize = 4096
+
+var (
+	ErrNoRequest      = errors.New("cookiestore: request not found in context; is the middleware installed?")
+	ErrCookieTooLarge = errors.New("cookiestore: encrypted session data exceeds the maximum cookie size")
+)
+
+type contextKey struct{}
+
+type exchange struct {
+	r *http.Request
+	w http.ResponseWriter
+}
+
+// Store is an scs session store which keeps the session data in an encrypted
+// cookie alongside the session token cookie, so no server-side storage is
+// needed. The data is sealed with AES-GCM using the session token as
+// additional data, so it can't be read, altered or paired with another token.
+//
+// Store only implements the context-aware methods usefully: it needs the
+// current request and response, which Middleware puts in the request context.
+// Middleware must run before the scs LoadAndSave middleware.
+type Store struct {
+	aead   cipher.AEAD
+	cookie http.Cookie
+}
+
+// New returns a Store which encrypts with a key derived from secret and
+// writes cookies based on the given template. Only the template's Name,
+// Path, Domain, Secure, HttpOnly and SameSite fields are used.
+func New(secret string, cookie http.Cookie) (*Store, error) {
+	key := sha256.Sum256([]byte(secret))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{aead: aead, cookie: cookie}, nil
+}
+
+// Middleware makes the request and response available to the store.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextKey{}, &exchange{r: r, w: w})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FindCtx decrypts the session data cookie sent with the request. Missing,
+// expired, tampered or undecryptable data is treated as no session.
+func (s *Store) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	ex, ok := ctx.Value(contextKey{}).(*exchange)
+	if !ok {
+		return nil, false, ErrNoRequest
+	}
+
+	cookie, err := ex.r.Cookie(s.cookie.Name)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, false, nil
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(token))
+	if err != nil || len(plaintext) < 8 {
+		return nil, false, nil
+	}
+
+	expiry := time.Unix(0, int64(binary.BigEndian.Uint64(plaintext[:8])))
+	if time.Now().After(expiry) {
+		return nil, false, nil
+	}
+
+	return plaintext[8:], true, nil
+}
+
+// CommitCtx encrypts the session data and sets it as a cookie on the
+// response.
+func (s *Store) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	ex, ok := ctx.Value(contextKey{}).(*exchange)
+	if !ok {
+		return ErrNoRequest
+	}
+
+	plaintext := make([]byte, 8, 8+len(b))
+	binary.BigEndian.PutUint64(plaintext, uint64(expiry.UnixNano()))
+	plaintext = append(plaintext, b...)
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(token))
+
+	value := base64.RawURLEncoding.EncodeToString(sealed)
+	if len(value) > maxCookieSize {
+		return fmt.Errorf("%w (%d bytes)", ErrCookieTooLarge, len(value))
+	}
+
+	s.setCookie(ex.w, value, expiry)
+	return nil
+}
+
+// DeleteCtx expires the session data cookie.
+func (s *Store) DeleteCtx(ctx context.Context, token string) error {
+	ex, ok := ctx.Value(contextKey{}).(*exchange)
+	if !ok {
+		return ErrNoRequest
+	}
+
+	s.setCookie(ex.w, "", time.Time{})
+	return nil
+}
+
+func (s *Store) setCookie(w http.ResponseWriter, value string, expiry time.Time) {
+	cookie := &http.Cookie{
+		Name:     s.cookie.Name,
+		Value:    value,
+		Path:     s.cookie.Path,
+		Domain:   s.cookie.Domain,
+		Secure:   s.cookie.Secure,
+		HttpOnly: s.cookie.HttpOnly,
+		SameSite: s.cookie.SameSite,
+	}
+
+	if expiry.IsZero() {
+		cookie.Expires = time.Unix(1, 0)
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = time.Unix(expiry.Unix()+1, 0)
+		cookie.MaxAge = int(time.Until(expiry).Seconds() + 1)
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+// Find, Commit and Delete satisfy scs.Store. They always fail, because the
+// store can't work without the request context.
+
+func (s *Store) Find(token string) ([]byte, bool, error) {
+	return nil, false, ErrNoRequest
+}
+
+func (s *Store) Commit(token string, b []byte, expiry time.Time) error {
+	return ErrNoRequest
+}
+
+func (s *Store) Delete(token string) error {
+	return ErrNoRequest
+}
@@ -0,0 +1,167 @@
+package cookiestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	secret      = "0123456789abcdef0123456789abcdef"
+	otherSecret = "fedcba9876543210fedcba9876543210"
+)
+
+func newTestStore(t *testing.T, secret string) *Store {
+	t.Helper()
+
+	store, err := New(secret, http.Cookie{Name: "session_data", Path: "/", HttpOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func contextFor(r *http.Request, w http.ResponseWriter) context.Context {
+	return context.WithValue(r.Context(), contextKey{}, &exchange{r: r, w: w})
+}
+
+// commit stores data for token and returns the value of the cookie written.
+func commit(t *testing.T, store *Store, token string, data []byte, expiry time.Time) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	err := store.CommitCtx(contextFor(r, rr), token, data, expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies; want 1", len(cookies))
+	}
+
+	return cookies[0].Value
+}
+
+// find looks up token in a request carrying value as the data cookie.
+func find(t *testing.T, store *Store, token, value string) ([]byte, bool) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session_data", Value: value})
+
+	b, found, err := store.FindCtx(contextFor(r, httptest.NewRecorder()), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b, found
+}
+
+// flipByte changes one byte of the sealed ciphertext in an encoded value.
+func flipByte(value string) string {
+	sealed, _ := base64.RawURLEncoding.DecodeString(value)
+	sealed[len(sealed)-1] ^= 0x01
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func TestFindCtx(t *testing.T) {
+	data := []byte("session data")
+
+	tests := []struct {
+		name      string
+		expiry    time.Time
+		findStore *Store
+		findToken string
+		mutate    func(string) string
+		wantFound bool
+	}{
+		{
+			name:      "Round trip",
+			expiry:    time.Now().Add(time.Hour),
+			findToken: "token",
+			wantFound: true,
+		},
+		{
+			name:      "Tampered ciphertext",
+			expiry:    time.Now().Add(time.Hour),
+			findToken: "token",
+			mutate:    flipByte,
+		},
+		{
+			name:      "Different token",
+			expiry:    time.Now().Add(time.Hour),
+			findToken: "another-token",
+		},
+		{
+			name:      "Wrong key",
+			expiry:    time.Now().Add(time.Hour),
+			findStore: newTestStore(t, otherSecret),
+			findToken: "token",
+		},
+		{
+			name:      "Expired",
+			expiry:    time.Now().Add(-time.Second),
+			findToken: "token",
+		},
+		{
+			name:      "Not base64",
+			expiry:    time.Now().Add(time.Hour),
+			findToken: "token",
+			mutate:    func(string) string { return "!!!" },
+		},
+		{
+			name:      "Shorter than a nonce",
+			expiry:    time.Now().Add(time.Hour),
+			findToken: "token",
+			mutate:    func(string) string { return "AAAA" },
+		},
+		{
+			name:      "Empty",
+			expiry:    time.Now().Add(time.Hour),
+			findToken: "token",
+			mutate:    func(string) string { return "" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t, secret)
+
+			value := commit(t, store, "token", data, tt.expiry)
+			if tt.mutate != nil {
+				value = tt.mutate(value)
+			}
+
+			findStore := store
+			if tt.findStore != nil {
+				findStore = tt.findStore
+			}
+
+			b, found := find(t, findStore, tt.findToken, value)
+			if found != tt.wantFound {
+				t.Fatalf("got found %t; want %t", found, tt.wantFound)
+			}
+
+			if tt.wantFound && !bytes.Equal(b, data) {
+				t.Errorf("got %q; want %q", b, data)
+			}
+		})
+	}
+}
+
+func TestNoMiddleware(t *testing.T) {
+	store := newTestStore(t, secret)
+
+	_, _, err := store.FindCtx(context.Background(), "token")
+	if err != ErrNoRequest {
+		t.Errorf("got %v; want %v", err, ErrNoRequest)
+	}
+}
@@ -0,0 +1,143 @@
+package jambuster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client is a typed client for the Jambuster backend API. Every call is
+// bound to the context it is given and additionally limited to timeout, so a
+// slow backend can't hold a request open indefinitely.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+}
+
+func New(baseURL string, httpClient *http.Client, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+		timeout:    timeout,
+	}
+}
+
+// do sends a request to the backend and decodes a successful response body
+// into dst, which may be nil. An empty token sends the request
+// unauthenticated.
+func (c *Client) do(ctx context.Context, method, endpoint, token string, body, dst any) error {
+	req, err := c.newJSONRequest(ctx, method, endpoint, token, body)
+	if err != nil {
+		return err
+	}
+
+	return c.send(req, dst)
+}
+
+// newJSONRequest builds a request to the backend with body, if not nil,
+// encoded as JSON.
+func (c *Client) newJSONRequest(ctx context.Context, method, endpoint, token string, body any) (*http.Request, error) {
+	var reqBody io.Reader
+
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req, nil
+}
+
+// send performs req and decodes a successful response body into dst, which
+// may be nil. Responses outside the 2xx range are translated into the errors
+// defined in errors.go.
+func (c *Client) send(req *http.Request, dst any) error {
+	if c.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), c.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+
+	if dst == nil {
+		// Drain the body so the underlying connection can be reused.
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	return readJSON(resp, dst)
+}
+
+func decodeError(resp *http.Response) error {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+
+	// The body is best-effort: a proxy in front of the backend may respond
+	// with HTML or nothing at all, in which case only the status is known.
+	_ = readJSON(resp, &envelope)
+
+	apiErr := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    http.StatusText(resp.StatusCode),
+	}
+
+	var message string
+	var fields map[string]string
+
+	switch {
+	case json.Unmarshal(envelope.Error, &message) == nil:
+		apiErr.Message = message
+
+	case json.Unmarshal(envelope.Error, &fields) == nil && resp.StatusCode == http.StatusUnprocessableEntity:
+		return &ValidationError{Fields: fields}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		// A 401 in response to a request carrying a bearer token means the
+		// token has expired or been revoked, rather than that the request
+		// needs one.
+		if resp.Request != nil && resp.Request.Header.Get("Authorization") != "" {
+			return fmt.Errorf("%w: %w", ErrInvalidAuthToken, apiErr)
+		}
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrNotFound, apiErr)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrForbidden, apiErr)
+	case http.StatusConflict:
+		return fmt.Errorf("%w: %w", ErrEditConflict, apiErr)
+	}
+
+	return apiErr
+}
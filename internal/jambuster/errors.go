@@ -0,0 +1,48 @@
+package jambuster
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrNotFound = errors.New("jambuster: resource not found")
+
+	ErrForbidden = errors.New("jambuster: forbidden")
+
+	ErrEditConflict = errors.New("jambuster: edit conflict")
+
+	ErrInvalidCredentials = errors.New("jambuster: invalid authentication credentials")
+
+	ErrInvalidAuthToken = errors.New("jambuster: invalid or expired authentication token")
+)
+
+// Error is returned when the backend responds with an unexpected status code.
+// Message holds the backend's error message when it sent one.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jambuster: status %d: %s", e.StatusCode, e.Message)
+}
+
+// ValidationError is returned when the backend rejects a request body with a
+// 422 Unprocessable Entity response. Fields maps each invalid JSON field to
+// the backend's message for it.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return fmt.Sprintf("jambuster: failed validation (%s)", strings.Join(keys, ", "))
+}
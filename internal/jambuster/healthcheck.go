@@ -0,0 +1,11 @@
+package jambuster
+
+import (
+	"context"
+	"net/http"
+)
+
+// Healthcheck reports whether the backend is up and answering requests.
+func (c *Client) Healthcheck(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/v1/healthcheck", "", nil, nil)
+}
@@ -0,0 +1,155 @@
+package jambuster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type Tune struct {
+	ID            int64     `json:"id"`             // Unique integer ID for the tune
+	CreatedAt     time.Time `json:"created_at"`     // Timestamp for when the tune is added to our database
+	Title         string    `json:"title"`          // Tune title
+	Styles        []string  `json:"styles"`         // Slice of styles for the tune (Bluegrass, old time, Irish, etc.)
+	Keys          []string  `json:"keys"`           // Slice of keys for the tune (ex: A major, G minor)
+	TimeSignature string    `json:"time_signature"` // Tune time signature
+	Structure     string    `json:"structure"`      // Tune structure (ex: AABA)
+	HasLyrics     bool      `json:"has_lyrics"`     // Whether or not the tune has lyrics
+	Version       int32     `json:"version"`        // The version number starts at 1 and is incremented on each update
+}
+
+type tuneEnvelope struct {
+	Tune Tune `json:"tune"`
+}
+
+type tunesEnvelope struct {
+	Tunes    []Tune   `json:"tunes"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// Metadata describes the page of results returned by a list endpoint.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// TuneFilters holds the search, pagination and sorting parameters accepted by
+// the tune listing endpoint. Zero values are left to the backend's defaults.
+type TuneFilters struct {
+	Title         string
+	Style         string
+	Key           string
+	TimeSignature string
+	Page          int
+	PageSize      int
+	Sort          string
+}
+
+func (f TuneFilters) query() url.Values {
+	query := url.Values{}
+
+	if f.Title != "" {
+		query.Set("title", f.Title)
+	}
+	if f.Style != "" {
+		query.Set("styles", f.Style)
+	}
+	if f.Key != "" {
+		query.Set("keys", f.Key)
+	}
+	if f.TimeSignature != "" {
+		query.Set("time_signature", f.TimeSignature)
+	}
+	if f.Page > 0 {
+		query.Set("page", strconv.Itoa(f.Page))
+	}
+	if f.PageSize > 0 {
+		query.Set("page_size", strconv.Itoa(f.PageSize))
+	}
+	if f.Sort != "" {
+		query.Set("sort", f.Sort)
+	}
+
+	return query
+}
+
+func (c *Client) GetTune(ctx context.Context, token string, id int64) (Tune, error) {
+	var envelope tuneEnvelope
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/tunes/%d", id), token, nil, &envelope)
+	if err != nil {
+		return Tune{}, err
+	}
+
+	return envelope.Tune, nil
+}
+
+func (c *Client) ListTunes(ctx context.Context, token string, filters TuneFilters) ([]Tune, Metadata, error) {
+	endpoint := "/v1/tunes"
+	if query := filters.query(); len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var envelope tunesEnvelope
+
+	err := c.do(ctx, http.MethodGet, endpoint, token, nil, &envelope)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return envelope.Tunes, envelope.Metadata, nil
+}
+
+// CreateTune creates a tune from the writable fields of tune and returns the
+// tune as stored by the backend.
+func (c *Client) CreateTune(ctx context.Context, token string, tune Tune) (Tune, error) {
+	input := map[string]any{
+		"title":          tune.Title,
+		"styles":         tune.Styles,
+		"keys":           tune.Keys,
+		"time_signature": tune.TimeSignature,
+		"structure":      tune.Structure,
+		"has_lyrics":     tune.HasLyrics,
+	}
+
+	var envelope tuneEnvelope
+
+	err := c.do(ctx, http.MethodPost, "/v1/tunes", token, input, &envelope)
+	if err != nil {
+		return Tune{}, err
+	}
+
+	return envelope.Tune, nil
+}
+
+// UpdateTune applies a partial update, keyed by JSON field name, to the tune
+// with the given id. The backend rejects the update with ErrEditConflict if
+// the tune is no longer at the expected version.
+func (c *Client) UpdateTune(ctx context.Context, token string, id int64, version int32, changes map[string]any) (Tune, error) {
+	endpoint := fmt.Sprintf("/v1/tunes/%d", id)
+
+	req, err := c.newJSONRequest(ctx, http.MethodPatch, endpoint, token, changes)
+	if err != nil {
+		return Tune{}, err
+	}
+	req.Header.Set("X-Expected-Version", strconv.FormatInt(int64(version), 10))
+
+	var envelope tuneEnvelope
+
+	err = c.send(req, &envelope)
+	if err != nil {
+		return Tune{}, err
+	}
+
+	return envelope.Tune, nil
+}
+
+func (c *Client) DeleteTune(ctx context.Context, token string, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/v1/tunes/%d", id), token, nil, nil)
+}
@@ -0,0 +1,155 @@
+package jambuster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Activated bool      `json:"activated"`
+}
+
+type AuthToken struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// RegisterUser creates a new, not yet activated, user. The backend emails the
+// user an activation token.
+func (c *Client) RegisterUser(ctx context.Context, name, email, password string) (User, error) {
+	input := map[string]string{
+		"name":     name,
+		"email":    email,
+		"password": password,
+	}
+
+	var envelope struct {
+		User User `json:"user"`
+	}
+
+	err := c.do(ctx, http.MethodPost, "/v1/users", "", input, &envelope)
+	if err != nil {
+		return User{}, err
+	}
+
+	return envelope.User, nil
+}
+
+func (c *Client) ActivateUser(ctx context.Context, token string) (User, error) {
+	input := map[string]string{
+		"token": token,
+	}
+
+	var envelope struct {
+		User User `json:"user"`
+	}
+
+	err := c.do(ctx, http.MethodPut, "/v1/users/activate", "", input, &envelope)
+	if err != nil {
+		return User{}, err
+	}
+
+	return envelope.User, nil
+}
+
+// CreateAuthToken exchanges a user's credentials for a bearer token. It
+// returns ErrInvalidCredentials if the backend rejects them.
+func (c *Client) CreateAuthToken(ctx context.Context, email, password string) (AuthToken, error) {
+	input := map[string]string{
+		"email":    email,
+		"password": password,
+	}
+
+	var envelope struct {
+		AuthToken AuthToken `json:"authentication_token"`
+	}
+
+	err := c.do(ctx, http.MethodPost, "/v1/tokens/authentication", "", input, &envelope)
+	if err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			return AuthToken{}, ErrInvalidCredentials
+		}
+		return AuthToken{}, err
+	}
+
+	return envelope.AuthToken, nil
+}
+
+// DeleteAuthToken revokes the given bearer token on the backend, so it can't
+// be used again even if it leaks.
+func (c *Client) DeleteAuthToken(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/tokens/authentication", token, nil, nil)
+}
+
+// GetCurrentUser returns the profile of the user the token belongs to.
+func (c *Client) GetCurrentUser(ctx context.Context, token string) (User, error) {
+	var envelope struct {
+		User User `json:"user"`
+	}
+
+	err := c.do(ctx, http.MethodGet, "/v1/users/me", token, nil, &envelope)
+	if err != nil {
+		return User{}, err
+	}
+
+	return envelope.User, nil
+}
+
+// UserUpdate holds the fields of a user to change. Nil fields are left as
+// they are.
+type UserUpdate struct {
+	Email    *string `json:"email,omitempty"`
+	Password *string `json:"password,omitempty"`
+}
+
+// UpdateCurrentUser applies update to the user the token belongs to.
+func (c *Client) UpdateCurrentUser(ctx context.Context, token string, update UserUpdate) (User, error) {
+	var envelope struct {
+		User User `json:"user"`
+	}
+
+	err := c.do(ctx, http.MethodPatch, "/v1/users/me", token, update, &envelope)
+	if err != nil {
+		return User{}, err
+	}
+
+	return envelope.User, nil
+}
+
+// CreateActivationToken asks the backend to email a new activation token to
+// the not yet activated user with the given address.
+func (c *Client) CreateActivationToken(ctx context.Context, email string) error {
+	input := map[string]string{
+		"email": email,
+	}
+
+	return c.do(ctx, http.MethodPost, "/v1/tokens/activation", "", input, nil)
+}
+
+// CreatePasswordResetToken asks the backend to email the user with the given
+// address a password reset token.
+func (c *Client) CreatePasswordResetToken(ctx context.Context, email string) error {
+	input := map[string]string{
+		"email": email,
+	}
+
+	return c.do(ctx, http.MethodPost, "/v1/tokens/password-reset", "", input, nil)
+}
+
+// ResetPassword sets a new password for the user identified by a password
+// reset token.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	input := map[string]string{
+		"password": password,
+		"token":    token,
+	}
+
+	return c.do(ctx, http.MethodPut, "/v1/users/password", "", input, nil)
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket rate limiter keyed by an arbitrary string, such
+// as a client IP address. Each key's bucket holds up to burst tokens and is
+// refilled at rate tokens per second.
+type Limiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. If the bucket is empty it returns
+// false and how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(float64(l.burst), b.tokens+now.Sub(b.lastSeen).Seconds()*l.rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Cleanup forgets keys which haven't been seen for longer than idle, so the
+// map doesn't grow without bound.
+func (l *Limiter) Cleanup(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if time.Since(b.lastSeen) > idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// FailureCounter counts failed attempts per key, such as failed logins for an
+// email address, and locks the key out once max failures have been recorded
+// within the lockout period.
+type FailureCounter struct {
+	max     int
+	lockout time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*failures
+}
+
+type failures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+func NewFailureCounter(max int, lockout time.Duration) *FailureCounter {
+	return &FailureCounter{
+		max:      max,
+		lockout:  lockout,
+		failures: make(map[string]*failures),
+	}
+}
+
+// Locked reports whether key is locked out, and if so for how much longer.
+func (c *FailureCounter) Locked(key string) (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.failures[key]
+	if !ok {
+		return false, 0
+	}
+
+	remaining := time.Until(f.lockedUntil)
+	return remaining > 0, max(remaining, 0)
+}
+
+// Fail records a failed attempt for key.
+func (c *FailureCounter) Fail(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	f, ok := c.failures[key]
+	if !ok || now.Sub(f.first) > c.lockout {
+		f = &failures{first: now}
+		c.failures[key] = f
+	}
+
+	f.count++
+	if f.count >= c.max {
+		f.lockedUntil = now.Add(c.lockout)
+	}
+}
+
+// Reset forgets the failed attempts for key, after a successful attempt.
+func (c *FailureCounter) Reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.failures, key)
+}
+
+// Cleanup forgets keys whose failures and lockout have both expired.
+func (c *FailureCounter) Cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	for key, f := range c.failures {
+		if now.Sub(f.first) > c.lockout && now.After(f.lockedUntil) {
+			delete(c.failures, key)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+var TimeSignatureRX = regexp.MustCompile(`^[1-9][0-9]?/(1|2|4|8|16|32)$`)
+
 type Validator struct {
 	NonFieldErrors []string
 	FieldErrors    map[string]string
@@ -56,3 +58,13 @@ func Matches(value string, rx *regexp.Regexp) bool {
 func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
 }
+
+func Unique[T comparable](values []T) bool {
+	uniqueValues := make(map[T]bool)
+
+	for _, value := range values {
+		uniqueValues[value] = true
+	}
+
+	return len(values) == len(uniqueValues)
+}